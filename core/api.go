@@ -49,6 +49,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	_log "log"
 	"os"
 	"sync"
@@ -73,28 +74,38 @@ const (
 
 	// User role if pre-defined
 	UserRoleKey
+
+	// Claims about the user from the JWT token or the auth webhook as a
+	// map[string]interface{}. These are available as $jwt.<claim> variables.
+	// Eg. $jwt.org_id
+	UserClaimsKey
+
+	// Name of the auth that authenticated the user when auths are chained
+	UserAuthKey
 )
 
 // GraphJin struct is an instance of the GraphJin engine it holds all the required information like
 // datase schemas, relationships, etc that the GraphQL to SQL compiler would need to do it's job.
 type GraphJin struct {
-	conf        *Config
-	db          *sql.DB
-	log         *_log.Logger
-	dbinfo      *sdata.DBInfo
-	schema      *sdata.DBSchema
-	allowList   *allow.List
-	encKey      [32]byte
-	queries     map[string]*cquery
-	roles       map[string]*Role
-	roleStmt    string
-	roleStmtMD  psql.Metadata
-	rmap        map[string]resItem
-	abacEnabled bool
-	qc          *qcode.Compiler
-	pc          *psql.Compiler
-	ge          *graphql.Engine
-	subs        sync.Map
+	conf         *Config
+	db           *sql.DB
+	log          *_log.Logger
+	dbinfo       *sdata.DBInfo
+	schema       *sdata.DBSchema
+	allowList    *allow.List
+	encKey       [32]byte
+	queries      map[string]*cquery
+	allowQueries map[string]*NamedQuery
+	roles        map[string]*Role
+	roleStmt     string
+	roleStmtMD   psql.Metadata
+	rmap         map[string]resItem
+	abacEnabled  bool
+	dbRoles      bool
+	qc           *qcode.Compiler
+	pc           *psql.Compiler
+	ge           *graphql.Engine
+	subs         sync.Map
 }
 
 // NewGraphJin creates the GraphJin struct, this involves querying the database to learn its
@@ -166,6 +177,7 @@ type Result struct {
 	name string
 	sql  string
 	role string
+	auth string
 
 	Error      string          `json:"message,omitempty"`
 	Data       json.RawMessage `json:"data,omitempty"`
@@ -175,6 +187,10 @@ type Result struct {
 // ReqConfig is used to pass request specific config values to the GraphQLEx and SubscribeEx functions. Dynamic variables can be set here.
 type ReqConfig struct {
 	Vars map[string]interface{}
+
+	// Roles are the active roles for the request, these must be
+	// roles the user has. Defaults to all the roles of the user
+	Roles []string
 }
 
 // GraphQL function is called on the GraphJin struct to convert the provided GraphQL query into an
@@ -209,6 +225,10 @@ func (gj *GraphJin) GraphQLEx(
 		name: ct.name,
 	}
 
+	if v, ok := c.Value(UserAuthKey).(string); ok {
+		res.auth = v
+	}
+
 	if ct.op == qcode.QTSubscription {
 		return res, errors.New("use 'core.Subscribe' for subscriptions")
 	}
@@ -217,6 +237,10 @@ func (gj *GraphJin) GraphQLEx(
 		return res, errors.New("mysql: mutations not supported")
 	}
 
+	if gj.db == nil {
+		return res, errNoDatabase
+	}
+
 	// use the chirino/graphql library for introspection queries
 	// disabled when allow list is enforced
 	if !gj.conf.EnforceAllowList && ct.name == "IntrospectionQuery" {
@@ -253,6 +277,32 @@ func (gj *GraphJin) GraphQLEx(
 	return res, err
 }
 
+// GraphQLByName runs a named query from the allow list. This allows services
+// like scheduled jobs to run saved queries without having the query text.
+func (gj *GraphJin) GraphQLByName(
+	c context.Context,
+	name string,
+	vars json.RawMessage,
+	rc *ReqConfig) (*Result, error) {
+
+	var err error
+
+	q, ok := gj.namedQueries()[name]
+
+	switch {
+	case !ok:
+		err = fmt.Errorf("query not found in allow list: %s", name)
+	case q.Operation == OpSubscription:
+		err = fmt.Errorf("use 'core.Subscribe' for subscriptions: %s", name)
+	}
+
+	if err != nil {
+		return &Result{name: name, Error: err.Error()}, err
+	}
+
+	return gj.GraphQLEx(c, q.Query, vars, rc)
+}
+
 // Operation function return the operation type and name from the query.
 // It uses a very fast algorithm to extract the operation without having to parse the query.
 func Operation(query string) (OpType, string) {
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/dosco/graphjin/core/internal/psql"
 	"github.com/dosco/graphjin/internal/jsn"
@@ -71,13 +73,20 @@ func (gj *GraphJin) argList(c context.Context, md psql.Metadata, vars []byte, rc
 				if err != nil {
 					return ar, err
 				}
-				vl[i] = v1
+				vl[i] = string(v1)
 			} else {
 				vl[i] = nil
 			}
 			ar.cindx = i
 
 		default:
+			if strings.HasPrefix(p.Name, "jwt.") {
+				if vl[i], err = claimArg(c, p); err != nil {
+					return ar, err
+				}
+				continue
+			}
+
 			if v, ok := fields[p.Name]; ok {
 				switch {
 				case p.IsArray && v[0] != '[':
@@ -157,12 +166,60 @@ func (gj *GraphJin) roleQueryArgList(c context.Context) (args, error) {
 			} else {
 				return ar, argErr(p)
 			}
+
+		default:
+			if strings.HasPrefix(p.Name, "jwt.") {
+				v, err := claimArg(c, p)
+				if err != nil {
+					return ar, err
+				}
+				vl[i] = v
+			}
 		}
 	}
 	ar.values = vl
 	return ar, nil
 }
 
+// claimArg returns the value of the JWT claim a variable like
+// $jwt.org_id or $jwt.app_metadata.org_id refers to
+func claimArg(c context.Context, p psql.Param) (interface{}, error) {
+	claims, ok := c.Value(UserClaimsKey).(map[string]interface{})
+	if !ok {
+		return nil, argErr(p)
+	}
+
+	var v interface{} = claims
+
+	for _, k := range strings.Split(p.Name[4:], ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, argErr(p)
+		}
+		if v, ok = m[k]; !ok || v == nil {
+			return nil, argErr(p)
+		}
+	}
+
+	switch v1 := v.(type) {
+	case string, bool:
+		return v1, nil
+
+	case json.Number:
+		return v1.String(), nil
+
+	case float64:
+		return strconv.FormatFloat(v1, 'f', -1, 64), nil
+
+	default:
+		b, err := json.Marshal(v1)
+		if err != nil {
+			return nil, fmt.Errorf("variable '%s': %w", p.Name, err)
+		}
+		return json.RawMessage(b), nil
+	}
+}
+
 func argErr(p psql.Param) error {
 	return fmt.Errorf("required variable '%s' of type '%s' must be set", p.Name, p.Type)
 }
@@ -24,7 +24,18 @@ func (gj *GraphJin) compileQuery(cq *cquery, role string) error {
 	// In production mode enforce the allow list and
 	// compile and cache the result else compile each time
 	if gj.allowList != nil && gj.conf.EnforceAllowList {
-		if cq1, ok := gj.queries[(cq.q.name + role)]; ok {
+		cq1, ok := gj.queries[(cq.q.name + role)]
+
+		// combined roles need the query to be allowed for each of the roles
+		if !ok && strings.IndexByte(role, ',') != -1 {
+			for _, r := range strings.Split(role, ",") {
+				if cq1, ok = gj.queries[(cq.q.name + r)]; !ok {
+					break
+				}
+			}
+		}
+
+		if ok {
 			cq.q = cq1.q
 		} else {
 			return errNotFound
@@ -47,14 +58,16 @@ func (gj *GraphJin) compileQueryFn(cq *cquery, role string) error {
 	var err error
 
 	switch cq.q.op {
-	case qcode.QTQuery, qcode.QTSubscription:
+	case qcode.QTQuery:
 		if gj.abacEnabled && role == "user" {
 			err = gj.buildMultiStmt(cq)
 		} else {
 			err = gj.buildRoleStmt(cq, role)
 		}
 
-	case qcode.QTMutation:
+	// subscriptions are shared by subscribers with the same
+	// role so the role is resolved before compiling
+	case qcode.QTSubscription, qcode.QTMutation:
 		err = gj.buildRoleStmt(cq, role)
 
 	default:
@@ -70,6 +83,12 @@ func (gj *GraphJin) buildRoleStmt(cq *cquery, role string) error {
 	vars := cq.q.vars
 
 	ro, ok := gj.roles[role]
+
+	// the qcode compiler combines the permissions of the roles
+	if !ok && strings.IndexByte(role, ',') != -1 {
+		ro, ok = &Role{Name: role}, true
+	}
+
 	if !ok {
 		return fmt.Errorf(`roles '%s' not defined in c.gj.config`, role)
 	}
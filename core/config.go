@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/dosco/graphjin/core/internal/qcode"
+	"github.com/dosco/graphjin/internal/envsubst"
 	"github.com/spf13/viper"
 )
 
@@ -31,11 +32,23 @@ type Config struct {
 	// path is assumed to be the same as the config path (allow.list)
 	AllowListFile string `mapstructure:"allow_list_file"`
 
-	// SetUserID forces the database session variable `user.id` to
-	// be set to the user id. This variables can be used by triggers
-	// or other database functions
+	// SetUserID sets the transaction local setting `user.id` to
+	// the user id. This setting can be used by triggers or other
+	// database functions
 	SetUserID bool `mapstructure:"set_user_id"`
 
+	// SessionSettings are set with set_config as transaction local settings
+	// before a query or mutation runs. Values can be variables like $user_id,
+	// $user_role, $jwt (all the claims as json), $jwt.org_id or header
+	// variables, other values are used as is. Row level security policies
+	// can read these using current_setting
+	SessionSettings map[string]string `mapstructure:"session_settings"`
+
+	// MarkMutations runs mutations in a transaction with the setting
+	// `graphjin.mutation` set to the name of the mutation. Database triggers
+	// use this to only record changes made through GraphJin
+	MarkMutations bool `mapstructure:"mark_mutations"`
+
 	// DefaultBlock ensures that in anonymous mode (role 'anon') all tables
 	// are blocked from queries and mutations. To open access to tables in
 	// anonymous mode they have to be added to the 'anon' role config.
@@ -74,6 +87,11 @@ type Config struct {
 	// you can add more custom roles.
 	Roles []Role
 
+	// MultipleRoles lets a user hold all the roles whose match is true instead
+	// of only the first one. The permissions of the roles are combined, filters
+	// are OR-ed and the columns of the roles are allowed
+	MultipleRoles bool `mapstructure:"multiple_roles"`
+
 	// Inflections is to add additionally singular to plural mappings
 	// to the engine (eg. sheep: sheep)
 	Inflections []string `mapstructure:"inflections"`
@@ -92,6 +110,16 @@ type Config struct {
 	// Defaults to 5 seconds
 	PollDuration time.Duration `mapstructure:"poll_every_seconds"`
 
+	// RoleCheckDuration sets how often (in seconds) the role of a subscriber
+	// is re-evaluated using the roles_query. Subscribers whose role has changed
+	// stop receiving updates. Defaults to 60 seconds
+	RoleCheckDuration time.Duration `mapstructure:"role_check_every_seconds"`
+
+	// SubsCatchUpPages is the max number of pages sent right away when a
+	// subscription is resumed using the cursor from its last update. Any
+	// remaining pages are sent with the regular updates. Defaults to 100
+	SubsCatchUpPages int `mapstructure:"subs_catch_up_pages"`
+
 	// DefaultLimit sets the default max limit (number of rows) when a
 	// limit is not defined in the query or the table role config.
 	// Default to 20
@@ -121,8 +149,17 @@ type Column struct {
 
 // Role struct contains role specific access control values for for all database tables
 type Role struct {
-	Name   string
-	Match  string
+	Name  string
+	Match string
+
+	// Extends is the list of roles whose tables are inherited, tables
+	// defined by the role replace the inherited table operations
+	Extends []string
+
+	// DBRole is the database role switched to with SET LOCAL ROLE
+	// when running queries and mutations with this role
+	DBRole string `mapstructure:"db_role"`
+
 	Tables []RoleTable
 	tm     map[string]*RoleTable
 }
@@ -348,7 +385,7 @@ func ReadInConfig(configFile string) (*Config, error) {
 
 	c := &Config{}
 
-	if err := vi.Unmarshal(&c); err != nil {
+	if err := vi.Unmarshal(&c, envsubst.DecoderOption); err != nil {
 		return nil, fmt.Errorf("failed to decode config, %v", err)
 	}
 
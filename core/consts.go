@@ -6,7 +6,8 @@ import (
 )
 
 var (
-	errNotFound = errors.New("not found in prepared statements")
+	errNotFound   = errors.New("not found in prepared statements")
+	errNoDatabase = errors.New("no database connection")
 )
 
 func keyExists(ct context.Context, key contextkey) bool {
@@ -4,7 +4,6 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/dosco/graphjin/core/internal/psql"
@@ -21,6 +20,19 @@ const (
 	OpMutation
 )
 
+func (o OpType) String() string {
+	switch o {
+	case OpQuery:
+		return "query"
+	case OpSubscription:
+		return "subscription"
+	case OpMutation:
+		return "mutation"
+	default:
+		return "unknown"
+	}
+}
+
 type extensions struct {
 	Tracing *trace `json:"tracing,omitempty"`
 }
@@ -173,16 +185,13 @@ func (c *scontext) resolveSQL(query string, vars []byte, role string) (qres, err
 	}
 	defer conn.Close()
 
-	if c.gj.conf.SetUserID {
-		if err := c.setLocalUserID(conn); err != nil {
-			return res, err
-		}
-	}
-
 	if v := c.Value(UserRoleKey); v != nil {
 		res.role = v.(string)
 
-	} else if c.gj.abacEnabled && c.op == qcode.QTMutation {
+	} else if c.gj.abacEnabled && (c.op == qcode.QTMutation || c.gj.dbRoles ||
+		c.gj.conf.MultipleRoles || len(c.rc.activeRoles()) != 0) {
+		// the role is needed upfront to switch to its database role
+		// or to combine the roles of the user
 		res.role, err = c.executeRoleQuery(conn)
 	}
 
@@ -190,6 +199,10 @@ func (c *scontext) resolveSQL(query string, vars []byte, role string) (qres, err
 		return res, err
 	}
 
+	if res.role, err = c.gj.activeRoles(res.role, c.rc.activeRoles()); err != nil {
+		return res, err
+	}
+
 	if err = c.gj.compileQuery(cq, res.role); err != nil {
 		return res, err
 	}
@@ -205,19 +218,38 @@ func (c *scontext) resolveSQL(query string, vars []byte, role string) (qres, err
 	// 	stime = time.Now()
 	// }
 
-	row := conn.QueryRowContext(c, cq.st.sql, args.values...)
+	var row *sql.Row
+	var tx *sql.Tx
+
+	marked := c.op == qcode.QTMutation && c.gj.conf.MarkMutations
+
+	if marked || c.gj.needsSession(res.role) {
+		if tx, err = c.beginTx(conn, res.role, marked); err != nil {
+			return res, err
+		}
+		defer tx.Rollback() //nolint: errcheck
+
+		row = tx.QueryRowContext(c, cq.st.sql, args.values...)
+	} else {
+		row = conn.QueryRowContext(c, cq.st.sql, args.values...)
+	}
+
 	if cq.roleArg {
 		err = row.Scan(&res.role, &res.data)
 	} else {
 		err = row.Scan(&res.data)
 	}
 
-	if err == sql.ErrNoRows {
-		return res, err
-	} else if err != nil {
+	if err != nil {
 		return res, err
 	}
 
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
+			return res, err
+		}
+	}
+
 	cur, err := c.gj.encryptCursor(cq.st.qc, res.data)
 	if err != nil {
 		return res, err
@@ -259,26 +291,54 @@ func (c *scontext) executeRoleQuery(conn *sql.Conn) (string, error) {
 		return "", err
 	}
 
-	err = conn.QueryRowContext(c, c.gj.roleStmt, ar.values...).Scan(&role)
+	if !c.gj.conf.SetUserID {
+		err = conn.QueryRowContext(c, c.gj.roleStmt, ar.values...).Scan(&role)
+		return role, err
+	}
+
+	// the roles query can use the user.id setting
+	tx, err := conn.BeginTx(c, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback() //nolint: errcheck
+
+	if v, ok := userIDValue(c); ok {
+		if _, err := tx.ExecContext(c, `SELECT set_config('user.id', $1, true)`, v); err != nil {
+			return "", err
+		}
+	}
+
+	err = tx.QueryRowContext(c, c.gj.roleStmt, ar.values...).Scan(&role)
 	return role, err
 }
 
-func (c *scontext) setLocalUserID(conn *sql.Conn) error {
-	var err error
+// beginTx starts a transaction with the session settings set, when marked the name
+// of the mutation is also set as a setting for database triggers to read.
+func (c *scontext) beginTx(conn *sql.Conn, role string, marked bool) (*sql.Tx, error) {
+	tx, err := conn.BeginTx(c, nil)
+	if err != nil {
+		return nil, err
+	}
 
-	if v := c.Value(UserIDKey); v == nil {
-		return nil
-	} else {
-		switch v1 := v.(type) {
-		case string:
-			_, err = conn.ExecContext(c, `SET SESSION "user.id" = '`+v1+`'`)
+	if marked {
+		name := c.name
+		if name == "" {
+			name = "anonymous"
+		}
 
-		case int:
-			_, err = conn.ExecContext(c, `SET SESSION "user.id" = `+strconv.Itoa(v1))
+		if _, err := tx.ExecContext(c, `SELECT set_config('graphjin.mutation', $1, true)`, name); err != nil {
+			tx.Rollback() //nolint: errcheck
+			return nil, err
 		}
 	}
 
-	return err
+	if err := c.gj.setSession(c, tx, role, c.rc); err != nil {
+		tx.Rollback() //nolint: errcheck
+		return nil, err
+	}
+
+	return tx, nil
 }
 
 func (r *Result) Operation() OpType {
@@ -306,6 +366,11 @@ func (r *Result) Role() string {
 	return r.role
 }
 
+// Auth returns the name of the auth that authenticated the user when auths are chained
+func (r *Result) Auth() string {
+	return r.auth
+}
+
 func (r *Result) SQL() string {
 	return r.sql
 }
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/dosco/graphjin/core/internal/qcode"
+	"github.com/dosco/graphjin/core/internal/sdata"
+)
+
+// QueryPlan contains the SQL generated for a query and the
+// execution plan returned by the database
+type QueryPlan struct {
+	Name string
+	Role string
+	SQL  string
+
+	// Plan is the output of `EXPLAIN (ANALYZE, VERBOSE, BUFFERS, FORMAT JSON)`,
+	// mutations are not run so their plan only has the estimates
+	Plan json.RawMessage
+
+	// Joins are the columns used to join the nested selections
+	// to their parents
+	Joins []JoinColumn
+}
+
+// JoinColumn is a table column used in a join condition
+type JoinColumn struct {
+	Schema string
+	Table  string
+	Column string
+}
+
+// Explain compiles the query for the role and returns the generated SQL with its
+// execution plan. Queries are run to collect the plan in a transaction that is
+// always rolled back, mutations are only planned. When the role is empty it's
+// resolved from the user in the context the same way as for queries. When no
+// variables are provided the ones saved with the query in the allow list are
+// used and missing variables are set to null.
+func (gj *GraphJin) Explain(
+	c context.Context,
+	query string,
+	vars json.RawMessage,
+	role string) (*QueryPlan, error) {
+
+	if gj.schema.Type() == "mysql" {
+		return nil, errors.New("mysql: explain not supported")
+	}
+
+	if gj.db == nil {
+		return nil, errNoDatabase
+	}
+
+	op, name := qcode.GetQType(query)
+
+	if role == "" {
+		var err error
+		if role, _, err = gj.subRole(c, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(vars) == 0 {
+		if nq, ok := gj.namedQueries()[name]; ok {
+			vars = nq.vars
+		}
+	}
+
+	cq := &cquery{q: rquery{op: op, name: name, query: []byte(query), vars: vars}}
+
+	if err := gj.buildRoleStmt(cq, role); err != nil {
+		return nil, err
+	}
+
+	qp := &QueryPlan{
+		Name:  name,
+		Role:  role,
+		SQL:   cq.st.sql,
+		Joins: joinColumns(cq.st.qc),
+	}
+
+	// an empty request config sets missing variables to null
+	args, err := gj.argList(c, cq.st.md, vars, &ReqConfig{})
+	if err != nil {
+		return qp, err
+	}
+
+	tx, err := gj.db.BeginTx(c, nil)
+	if err != nil {
+		return qp, err
+	}
+	defer tx.Rollback() //nolint: errcheck
+
+	if err := gj.setSession(c, tx, role, nil); err != nil {
+		return qp, err
+	}
+
+	opts := `ANALYZE, VERBOSE, BUFFERS, FORMAT JSON`
+	if op == qcode.QTMutation {
+		opts = `VERBOSE, FORMAT JSON`
+	}
+
+	err = tx.QueryRowContext(c,
+		`EXPLAIN (`+opts+`) `+cq.st.sql,
+		args.values...).Scan(&qp.Plan)
+
+	if err != nil {
+		return qp, fmt.Errorf("explain: %w", err)
+	}
+
+	return qp, nil
+}
+
+// joinColumns returns the columns on the joined tables that are
+// matched against the parent in the join conditions
+func joinColumns(qc *qcode.QCode) []JoinColumn {
+	var cols []JoinColumn
+	seen := make(map[JoinColumn]struct{})
+
+	add := func(rel sdata.DBRel) {
+		switch rel.Type {
+		case sdata.RelOneToOne, sdata.RelOneToMany, sdata.RelRecursive:
+		default:
+			return
+		}
+
+		jc := JoinColumn{
+			Schema: rel.Left.Col.Schema,
+			Table:  rel.Left.Col.Table,
+			Column: rel.Left.Col.Name,
+		}
+
+		if _, ok := seen[jc]; !ok {
+			seen[jc] = struct{}{}
+			cols = append(cols, jc)
+		}
+	}
+
+	for _, sel := range qc.Selects {
+		if sel.SkipRender != qcode.SkipTypeNone {
+			continue
+		}
+
+		for _, rel := range sel.Joins {
+			add(rel)
+		}
+
+		if sel.ParentID != -1 {
+			add(sel.Rel)
+		}
+	}
+
+	return cols
+}
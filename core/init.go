@@ -42,6 +42,10 @@ func (gj *GraphJin) initConfig() error {
 		}
 	}
 
+	if err := mergeRoles(c); err != nil {
+		return err
+	}
+
 	gj.roles = make(map[string]*Role)
 
 	for i, role := range c.Roles {
@@ -58,6 +62,14 @@ func (gj *GraphJin) initConfig() error {
 		}
 
 		gj.roles[k] = &c.Roles[i]
+
+		if role.DBRole != "" {
+			gj.dbRoles = true
+		}
+	}
+
+	if c.DBType == "mysql" && (gj.dbRoles || len(c.SessionSettings) != 0) {
+		return fmt.Errorf("mysql: session_settings and db_role not supported")
 	}
 
 	// If user role not defined then create it
@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"text/scanner"
 
@@ -29,6 +31,8 @@ type Item struct {
 	key     string
 	Query   string
 	Vars    string
+	File    string
+	Line    int
 	frags   []Frag
 }
 
@@ -159,12 +163,99 @@ func (al *List) Load() ([]Item, error) {
 		if err != nil {
 			return nil, err
 		}
+
+		if len(item) == 0 {
+			continue
+		}
+
+		item[0].File = fn
+		item[0].Line = 1
+
+		if n := bytes.Index(b, []byte(item[0].Query)); n != -1 {
+			item[0].Line += bytes.Count(b[:n], []byte("\n"))
+		}
 		items = append(items, item[0])
 	}
 
 	return items, nil
 }
 
+// Fragments returns all the saved fragments
+func (al *List) Fragments() ([]Frag, error) {
+	var frags []Frag
+
+	files, err := ioutil.ReadDir(al.fragmentPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("allow list: %w", err)
+	}
+
+	for _, f := range files {
+		b, err := ioutil.ReadFile(path.Join(al.fragmentPath, f.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("allow list: %w", err)
+		}
+		v := strings.TrimSpace(string(b))
+		frags = append(frags, Frag{Name: QueryName(v), Value: v})
+	}
+
+	return frags, nil
+}
+
+// Remove deletes the query file of the item
+func (al *List) Remove(item Item) error {
+	if item.File == "" || path.Dir(item.File) != al.queryPath {
+		return fmt.Errorf("allow list: query file not found: %s", item.Name)
+	}
+	return os.Remove(item.File)
+}
+
+// Export writes all the queries and fragments to a single file in the
+// allow.list format. Placing this file in the config folder of a new
+// deployment recreates the queries and fragments folders from it.
+func (al *List) Export(w io.Writer) error {
+	items, err := al.Load()
+	if err != nil {
+		return err
+	}
+
+	frags, err := al.Fragments()
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Name < items[j].Name
+	})
+
+	for _, v := range items {
+		if _, err := fmt.Fprintf(w, "/* %s */\n\n", v.Name); err != nil {
+			return err
+		}
+
+		if v.Vars != "" {
+			if _, err := fmt.Fprintf(w, "variables %s\n\n", v.Vars); err != nil {
+				return err
+			}
+		}
+
+		if _, err := fmt.Fprintf(w, "%s\n\n", v.Query); err != nil {
+			return err
+		}
+	}
+
+	// fragments following a query are saved along with
+	// it when the file is loaded
+	for _, f := range frags {
+		if _, err := fmt.Fprintf(w, "%s\n\n", f.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (al *List) FragmentFetcher() func(name string) (string, error) {
 	return func(name string) (string, error) {
 		v, err := ioutil.ReadFile(path.Join(al.fragmentPath, name))
@@ -1,6 +1,10 @@
 package allow
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
 	"testing"
 )
 
@@ -239,3 +243,78 @@ func TestParse2(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	al, err := New(path.Join(dir, "allow.list"), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := al.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"queries/getUser":  "variables {\n  \"id\": 1\n}\n\nquery getUser {\n  user(id: $id) {\n    ...User\n  }\n}\n",
+		"queries/getPosts": "query getPosts {\n  posts {\n    id\n  }\n}\n",
+		"fragments/User":   "fragment User on users {\n  id\n  email\n}\n",
+	}
+
+	for k, v := range files {
+		if err := ioutil.WriteFile(path.Join(dir, k), []byte(v), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, err := al.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range items {
+		if v.Name == "getUser" && (v.Line != 5 || v.File != path.Join(dir, "queries/getUser")) {
+			t.Errorf("unexpected location for getUser: %s:%d", v.File, v.Line)
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := al.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := parse(buf.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 2 || list[0].Name != "getPosts" || list[1].Name != "getUser" {
+		t.Fatalf("unexpected export: %s", buf.String())
+	}
+
+	if list[1].Vars != "{\n  \"id\": 1\n}" || len(list[1].frags) != 1 || list[1].frags[0].Name != "User" {
+		t.Errorf("unexpected export of getUser: %+v", list[1])
+	}
+
+	for _, v := range items {
+		if v.Name == "getPosts" {
+			if err := al.Remove(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if items, err = al.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 1 || items[0].Name != "getUser" {
+		t.Errorf("expected getPosts to be removed")
+	}
+}
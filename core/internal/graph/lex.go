@@ -182,6 +182,23 @@ func (l *lexer) acceptAlphaNum() bool {
 	return (n != 0)
 }
 
+// acceptVarName consumes a variable name, names can be
+// a dot separated path like jwt.org_id
+func (l *lexer) acceptVarName() bool {
+	if !l.acceptAlphaNum() {
+		return false
+	}
+	for l.peek() == '.' {
+		r, _ := utf8.DecodeRune(l.input[l.pos+1:])
+		if !isAlphaNumeric(r) {
+			break
+		}
+		l.next()
+		l.acceptAlphaNum()
+	}
+	return true
+}
+
 // acceptComment consumes a run of runes while till the end of line
 func (l *lexer) acceptComment() {
 	n := 0
@@ -254,7 +271,7 @@ func lexRoot(l *lexer) stateFn {
 		l.emit(itemDirective)
 	case r == '$':
 		l.ignore()
-		if l.acceptAlphaNum() {
+		if l.acceptVarName() {
 			// lowercase(l.current())
 			l.emit(itemVariable)
 		}
@@ -116,3 +116,15 @@ func BenchmarkSchemaParseP(b *testing.B) {
 		}
 	})
 }
+
+func TestParseVarPath(t *testing.T) {
+	node, err := ParseArgValue(`{ org_id: { eq: $jwt.app_metadata.org_id } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := node.Children[0].Children[0]
+	if v.Type != NodeVar || v.Val != "jwt.app_metadata.org_id" {
+		t.Fatalf("expected variable 'jwt.app_metadata.org_id' got %s '%s'", v.Type, v.Val)
+	}
+}
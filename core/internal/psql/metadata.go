@@ -28,7 +28,8 @@ func (c *compilerContext) renderVar(vv string) {
 			!(v >= 'A' && v <= 'Z') &&
 			!(v >= '0' && v <= '9') &&
 			v != '_' &&
-			v != ':':
+			v != ':' &&
+			!(v == '.' && i+1 < len(vv) && isVarChar(vv[i+1])):
 			name, _type := parseVar(vv[f+1 : i])
 			c.renderParam(Param{Name: name, Type: _type})
 			s = i
@@ -47,6 +48,15 @@ func (c *compilerContext) renderVar(vv string) {
 	}
 }
 
+// isVarChar returns true for the characters a variable
+// path like jwt.org_id can continue with after a dot
+func isVarChar(v byte) bool {
+	return (v >= 'a' && v <= 'z') ||
+		(v >= 'A' && v <= 'Z') ||
+		(v >= '0' && v <= '9') ||
+		v == '_'
+}
+
 // nolint: errcheck
 func (c *compilerContext) renderParam(p Param) {
 	var id int
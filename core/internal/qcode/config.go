@@ -166,6 +166,10 @@ func (co *Compiler) getRole(role, field string) trval {
 	var tr trval
 	var ok bool
 
+	if strings.IndexByte(role, ',') != -1 {
+		return co.getCombinedRole(role, field)
+	}
+
 	// For anon roles when a trval is not found return the default trval
 	if tr, ok = co.tr[(role + field)]; !ok && role != "anon" {
 		tr.role = role
@@ -177,6 +181,155 @@ func (co *Compiler) getRole(role, field string) trval {
 	return tr
 }
 
+// getCombinedRole returns the union of the permissions of a comma separated
+// list of roles. Operations are allowed if any of the roles allows them, the
+// filters of the roles that allow them are OR-ed and their columns combined.
+func (co *Compiler) getCombinedRole(role, field string) trval {
+	var trs []trval
+
+	for _, r := range strings.Split(role, ",") {
+		trs = append(trs, co.getRole(r, field))
+	}
+
+	tr := trval{role: role}
+	tr.query.block = true
+	tr.query.disable.funcs = true
+
+	var qf, uf, pf, df []*Exp
+	var qnu, unu, pnu, dnu []bool
+	var qc, ic, uc, pc, dc []map[string]struct{}
+
+	tr.insert.block = true
+	tr.update.block = true
+	tr.upsert.block = true
+	tr.delete.block = true
+
+	for i := range trs {
+		t := &trs[i]
+
+		if !t.query.block {
+			tr.query.block = false
+			// roles without a limit use the default limit
+			l := t.query.limit
+			if l == 0 {
+				l = co.defaultLimit()
+			}
+			if l > tr.query.limit {
+				tr.query.limit = l
+			}
+			if !t.query.disable.funcs {
+				tr.query.disable.funcs = false
+			}
+			qf, qnu = append(qf, t.query.fil), append(qnu, t.query.filNU)
+			qc = append(qc, t.query.cols)
+		}
+
+		if !t.insert.block {
+			tr.insert.block = false
+			tr.insert.presets = mergePresets(tr.insert.presets, t.insert.presets)
+			ic = append(ic, t.insert.cols)
+		}
+
+		if !t.update.block {
+			tr.update.block = false
+			tr.update.presets = mergePresets(tr.update.presets, t.update.presets)
+			uf, unu = append(uf, t.update.fil), append(unu, t.update.filNU)
+			uc = append(uc, t.update.cols)
+		}
+
+		if !t.upsert.block {
+			tr.upsert.block = false
+			tr.upsert.presets = mergePresets(tr.upsert.presets, t.upsert.presets)
+			pf, pnu = append(pf, t.upsert.fil), append(pnu, t.upsert.filNU)
+			pc = append(pc, t.upsert.cols)
+		}
+
+		if !t.delete.block {
+			tr.delete.block = false
+			df, dnu = append(df, t.delete.fil), append(dnu, t.delete.filNU)
+			dc = append(dc, t.delete.cols)
+		}
+	}
+
+	if tr.query.block {
+		tr.query.disable.funcs = false
+	}
+
+	tr.query.fil, tr.query.filNU = unionFilters(qf, qnu)
+	tr.update.fil, tr.update.filNU = unionFilters(uf, unu)
+	tr.upsert.fil, tr.upsert.filNU = unionFilters(pf, pnu)
+	tr.delete.fil, tr.delete.filNU = unionFilters(df, dnu)
+
+	tr.query.cols = unionCols(qc)
+	tr.insert.cols = unionCols(ic)
+	tr.update.cols = unionCols(uc)
+	tr.upsert.cols = unionCols(pc)
+	tr.delete.cols = unionCols(dc)
+
+	return tr
+}
+
+// unionFilters OR's the filters, a role without a filter
+// allows all rows and false filters are dropped
+func unionFilters(fils []*Exp, nus []bool) (*Exp, bool) {
+	var ex []*Exp
+	var nu bool
+
+	for i, f := range fils {
+		if f == nil || f.Op == OpNop {
+			return nil, false
+		}
+		if f.Op == OpFalse {
+			continue
+		}
+		ex = append(ex, f)
+		nu = nu || nus[i]
+	}
+
+	switch len(ex) {
+	case 0:
+		if len(fils) == 0 {
+			return nil, false
+		}
+		return &Exp{Op: OpFalse, doFree: false}, false
+	case 1:
+		return ex[0], nu
+	default:
+		return &Exp{Op: OpOr, Children: ex, doFree: false}, nu
+	}
+}
+
+// unionCols combines the columns, an empty set allows all columns
+func unionCols(cols []map[string]struct{}) map[string]struct{} {
+	m := make(map[string]struct{})
+
+	for _, c := range cols {
+		if len(c) == 0 {
+			return nil
+		}
+		for k := range c {
+			m[k] = struct{}{}
+		}
+	}
+	return m
+}
+
+// mergePresets adds the presets that are not already set
+func mergePresets(m, presets map[string]string) map[string]string {
+	if len(presets) == 0 {
+		return m
+	}
+	if m == nil {
+		m = make(map[string]string, len(presets))
+	}
+	for k, v := range presets {
+		if _, ok := m[k]; !ok {
+			m[k] = v
+		}
+	}
+	return m
+}
+
 func (trv *trval) filter(qt QType) (*Exp, bool) {
 	switch qt {
 	case QTQuery:
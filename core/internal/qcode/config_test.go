@@ -0,0 +1,106 @@
+package qcode
+
+import (
+	"testing"
+
+	"github.com/dosco/graphjin/core/internal/sdata"
+)
+
+func TestGetCombinedRole(t *testing.T) {
+	dbs, err := sdata.NewDBSchema(sdata.GetTestDBInfo(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	co, err := NewCompiler(dbs, Config{DefaultLimit: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = co.AddRole("editor", "public", "products", TRConfig{
+		Query:  QueryConfig{Filters: []string{"{ user_id: { eq: $user_id } }"}, Columns: []string{"id", "name"}},
+		Update: UpdateConfig{Columns: []string{"name"}},
+		Insert: InsertConfig{Block: true},
+		Delete: DeleteConfig{Block: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = co.AddRole("viewer", "public", "products", TRConfig{
+		Query:  QueryConfig{Filters: []string{"{ price: { gt: 10 } }"}, Columns: []string{"id", "price"}, Limit: 20},
+		Insert: InsertConfig{Block: true},
+		Update: UpdateConfig{Block: true},
+		Delete: DeleteConfig{Block: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := co.getRole("editor,viewer", "products")
+
+	// the editor has no limit so it gets the default limit
+	if tr.role != "editor,viewer" || tr.query.block || tr.query.limit != 50 {
+		t.Errorf("expected the query to be allowed with a limit of 50 got %+v", tr.query)
+	}
+
+	if tr.query.fil == nil || tr.query.fil.Op != OpOr || len(tr.query.fil.Children) != 2 || !tr.query.filNU {
+		t.Errorf("expected the query filters to be OR-ed got %+v", tr.query.fil)
+	}
+
+	for _, c := range []string{"id", "name", "price"} {
+		if _, ok := tr.query.cols[c]; !ok {
+			t.Errorf("expected the query columns to include '%s'", c)
+		}
+	}
+
+	// only the editor can update and it has no update filter
+	if tr.update.block || tr.update.fil != nil || len(tr.update.cols) != 1 {
+		t.Errorf("expected the editor update permissions got %+v", tr.update)
+	}
+
+	if !tr.insert.block || !tr.delete.block {
+		t.Error("expected inserts and deletes to be blocked")
+	}
+
+	// a role without a query filter allows all rows and columns
+	tr = co.getRole("editor,user", "products")
+
+	if tr.query.fil != nil || tr.query.cols != nil {
+		t.Errorf("expected all rows and columns to be allowed got %+v", tr.query)
+	}
+}
+
+func TestUnionFilters(t *testing.T) {
+	f1 := &Exp{Op: OpEquals}
+	f2 := &Exp{Op: OpGreaterThan}
+	ff := &Exp{Op: OpFalse}
+
+	tests := []struct {
+		name string
+		fils []*Exp
+		nus  []bool
+		op   ExpOp
+		nu   bool
+	}{
+		{"single", []*Exp{f1, ff}, []bool{true, false}, OpEquals, true},
+		{"or", []*Exp{f1, f2}, []bool{false, true}, OpOr, true},
+		{"false", []*Exp{ff, ff}, []bool{false, false}, OpFalse, false},
+	}
+
+	for _, v := range tests {
+		f, nu := unionFilters(v.fils, v.nus)
+
+		if f == nil || f.Op != v.op || nu != v.nu {
+			t.Errorf("%s: expected op %d (%t) got %+v (%t)", v.name, v.op, v.nu, f, nu)
+		}
+	}
+
+	if f, _ := unionFilters([]*Exp{f1, {Op: OpNop}}, []bool{true, false}); f != nil {
+		t.Errorf("expected no filter when a role has none got %+v", f)
+	}
+
+	if f, _ := unionFilters(nil, nil); f != nil {
+		t.Errorf("expected no filter without roles got %+v", f)
+	}
+}
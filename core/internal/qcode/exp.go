@@ -3,6 +3,7 @@ package qcode
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/dosco/graphjin/core/internal/graph"
 	"github.com/dosco/graphjin/core/internal/sdata"
@@ -64,7 +65,7 @@ func (co *Compiler) compileArgNode(
 			continue
 		}
 
-		if ex.Type == ValVar && ex.Val == "user_id" {
+		if ex.Type == ValVar && (ex.Val == "user_id" || strings.HasPrefix(ex.Val, "jwt.")) {
 			needsUser = true
 		}
 
@@ -522,14 +522,18 @@ func (co *Compiler) setLimit(tr trval, qc *QCode, sel *Select) {
 	if l := tr.limit(qc.Type); l != 0 {
 		sel.Paging.Limit = l
 
-		// Else use default limit from config
-	} else if co.c.DefaultLimit != 0 {
-		sel.Paging.Limit = int32(co.c.DefaultLimit)
-
-		// Else just go with 20
+		// Else use default limit
 	} else {
-		sel.Paging.Limit = 20
+		sel.Paging.Limit = co.defaultLimit()
+	}
+}
+
+// defaultLimit returns the default limit from config else just go with 20
+func (co *Compiler) defaultLimit() int32 {
+	if co.c.DefaultLimit != 0 {
+		return int32(co.c.DefaultLimit)
 	}
+	return 20
 }
 
 // This
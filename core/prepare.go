@@ -42,19 +42,36 @@ func (gj *GraphJin) prepareRoleStmt() error {
 	gj.pc.RenderVar(w, &gj.roleStmtMD, gj.conf.RolesQuery)
 	io.WriteString(w, `) THEN `)
 
-	io.WriteString(w, `(SELECT (CASE`)
-	for _, role := range gj.conf.Roles {
-		if role.Match == "" {
-			continue
+	if gj.conf.MultipleRoles {
+		// all the matching roles as a comma separated list
+		io.WriteString(w, `(SELECT COALESCE(NULLIF(concat_ws(','`)
+		for _, role := range gj.conf.Roles {
+			if role.Match == "" {
+				continue
+			}
+			io.WriteString(w, `, CASE WHEN `)
+			io.WriteString(w, role.Match)
+			io.WriteString(w, ` THEN '`)
+			io.WriteString(w, role.Name)
+			io.WriteString(w, `' END`)
+		}
+		io.WriteString(w, `), ''), 'user') FROM (`)
+
+	} else {
+		io.WriteString(w, `(SELECT (CASE`)
+		for _, role := range gj.conf.Roles {
+			if role.Match == "" {
+				continue
+			}
+			io.WriteString(w, ` WHEN `)
+			io.WriteString(w, role.Match)
+			io.WriteString(w, ` THEN '`)
+			io.WriteString(w, role.Name)
+			io.WriteString(w, `'`)
 		}
-		io.WriteString(w, ` WHEN `)
-		io.WriteString(w, role.Match)
-		io.WriteString(w, ` THEN '`)
-		io.WriteString(w, role.Name)
-		io.WriteString(w, `'`)
+		io.WriteString(w, ` ELSE 'user' END) FROM (`)
 	}
 
-	io.WriteString(w, ` ELSE 'user' END) FROM (`)
 	gj.pc.RenderVar(w, &gj.roleStmtMD, gj.conf.RolesQuery)
 	io.WriteString(w, `) AS "_sg_auth_roles_query" LIMIT 1) `)
 	io.WriteString(w, `ELSE 'anon' END) FROM (VALUES (1)) AS "_sg_auth_filler" LIMIT 1; `)
@@ -80,6 +97,7 @@ func (gj *GraphJin) initAllowList() error {
 	}
 
 	gj.queries = make(map[string]*cquery)
+	gj.allowQueries = make(map[string]*NamedQuery)
 
 	list, err := gj.allowList.Load()
 	if err != nil {
@@ -100,12 +118,14 @@ func (gj *GraphJin) initAllowList() error {
 			vars:  []byte(v.Vars),
 		}
 
-		switch q.op {
-		case qcode.QTQuery, qcode.QTSubscription:
-			gj.queries[(v.Name + "user")] = &cquery{q: q}
-			gj.queries[(v.Name + "anon")] = &cquery{q: q}
+		if v.Name != "" {
+			gj.allowQueries[v.Name] = newNamedQuery(qt, v)
+		}
 
-		case qcode.QTMutation:
+		// queries can also run with any role set
+		// using the UserRoleKey
+		switch q.op {
+		case qcode.QTQuery, qcode.QTSubscription, qcode.QTMutation:
 			for _, role := range gj.conf.Roles {
 				gj.queries[(v.Name + role.Name)] = &cquery{q: q}
 			}
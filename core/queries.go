@@ -0,0 +1,313 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/chirino/graphql/schema"
+	"github.com/dosco/graphjin/core/internal/allow"
+	"github.com/dosco/graphjin/core/internal/qcode"
+)
+
+// NamedQuery describes a named query or mutation from the allow list
+type NamedQuery struct {
+	Name      string
+	Comment   string
+	Operation OpType
+	Query     string
+	Vars      []QueryVar
+
+	// File and Line are where the query is saved
+	File string
+	Line int
+
+	vars []byte
+}
+
+// QueryVar is a variable declared by a named query
+// eg. `query getProduct($id: ID!) { ... }`
+type QueryVar struct {
+	Name string
+
+	// Type is the name of the GraphQL type (Int, Float, String, ID,
+	// Boolean or an input type)
+	Type     string
+	List     bool
+	Required bool
+
+	// Default is the GraphQL literal of the default value if any
+	Default string
+}
+
+// QueryField describes a field in the json result of a query
+type QueryField struct {
+	Name string
+
+	// Type is the database type of the column, it is
+	// empty for nested selections
+	Type    string
+	Array   bool
+	NotNull bool
+
+	// List is set when a nested selection returns a list
+	List   bool
+	Fields []QueryField
+}
+
+// namedQueries returns the named queries from the allow list. When the allow
+// list is not enforced (dev mode) queries are saved to it as they are run so
+// it's read again on every call instead of using the set loaded at startup.
+func (gj *GraphJin) namedQueries() map[string]*NamedQuery {
+	if gj.allowList == nil || gj.conf.EnforceAllowList {
+		return gj.allowQueries
+	}
+
+	list, err := gj.allowList.Load()
+	if err != nil {
+		gj.log.Printf("Allow List Error: %s", err)
+		return gj.allowQueries
+	}
+
+	qm := make(map[string]*NamedQuery, len(list))
+
+	for _, v := range list {
+		if v.Query == "" || v.Name == "" {
+			continue
+		}
+		qt, _ := qcode.GetQType(v.Query)
+		qm[v.Name] = newNamedQuery(qt, v)
+	}
+
+	return qm
+}
+
+// NamedQueries returns all the named queries and mutations
+// from the allow list sorted by name
+func (gj *GraphJin) NamedQueries() []NamedQuery {
+	qm := gj.namedQueries()
+	list := make([]NamedQuery, 0, len(qm))
+
+	for _, v := range qm {
+		list = append(list, *v)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
+
+// NamedQuery returns the named query or mutation from the allow list
+func (gj *GraphJin) NamedQuery(name string) (NamedQuery, bool) {
+	if v, ok := gj.namedQueries()[name]; ok {
+		return *v, true
+	}
+	return NamedQuery{}, false
+}
+
+// RoleCheck is the result of compiling a query for a role
+type RoleCheck struct {
+	Role string
+	Err  error
+}
+
+// CheckNamedQuery compiles the named query for every role without running it,
+// a nil error means the role can run the query. This is used to find queries
+// that no longer work with the current database schema.
+func (gj *GraphJin) CheckNamedQuery(name string) ([]RoleCheck, error) {
+	nq, ok := gj.namedQueries()[name]
+	if !ok {
+		return nil, fmt.Errorf("query not found in allow list: %s", name)
+	}
+
+	qt, _ := qcode.GetQType(nq.Query)
+	checks := make([]RoleCheck, 0, len(gj.conf.Roles))
+
+	for _, role := range gj.conf.Roles {
+		cq := &cquery{q: rquery{op: qt, name: name, query: []byte(nq.Query), vars: nq.vars}}
+
+		checks = append(checks, RoleCheck{
+			Role: role.Name,
+			Err:  gj.buildRoleStmt(cq, role.Name),
+		})
+	}
+
+	return checks, nil
+}
+
+// RemoveNamedQuery deletes the saved named query from the allow list
+func (gj *GraphJin) RemoveNamedQuery(name string) error {
+	nq, ok := gj.namedQueries()[name]
+	if !ok {
+		return fmt.Errorf("query not found in allow list: %s", name)
+	}
+
+	if err := gj.allowList.Remove(allow.Item{Name: nq.Name, File: nq.File}); err != nil {
+		return err
+	}
+
+	delete(gj.allowQueries, name)
+
+	for _, role := range gj.conf.Roles {
+		delete(gj.queries, (name + role.Name))
+	}
+
+	return nil
+}
+
+// ExportAllowList writes all the queries and fragments in the
+// allow list to a single file in the allow.list format
+func (gj *GraphJin) ExportAllowList(w io.Writer) error {
+	if gj.allowList == nil {
+		return errors.New("allow list is disabled")
+	}
+	return gj.allowList.Export(w)
+}
+
+func newNamedQuery(qt qcode.QType, item allow.Item) *NamedQuery {
+	nq := &NamedQuery{
+		Name:      item.Name,
+		Comment:   item.Comment,
+		Operation: OpType(qt),
+		Query:     item.Query,
+		File:      item.File,
+		Line:      item.Line,
+		vars:      []byte(item.Vars),
+	}
+
+	switch qt {
+	case qcode.QTMutation, qcode.QTInsert, qcode.QTUpdate, qcode.QTUpsert, qcode.QTDelete:
+		nq.Operation = OpMutation
+	}
+
+	qd := &schema.QueryDocument{}
+
+	// the query is parsed again when compiled so errors
+	// are reported then
+	if err := qd.Parse(item.Query); err != nil || len(qd.Operations) == 0 {
+		return nq
+	}
+
+	for _, v := range qd.Operations[0].Vars {
+		qv := QueryVar{Name: v.Name}
+
+		t := v.Type
+		if nn, ok := t.(*schema.NonNull); ok {
+			qv.Required = true
+			t = nn.OfType
+		}
+
+		if l, ok := t.(*schema.List); ok {
+			qv.List = true
+			t = l.OfType
+		}
+
+		// unwrap the list item type
+		if nn, ok := t.(*schema.NonNull); ok {
+			t = nn.OfType
+		}
+
+		if tn, ok := t.(*schema.TypeName); ok {
+			qv.Type = tn.Name
+		}
+
+		if v.Default != nil {
+			qv.Default = v.Default.String()
+			qv.Required = false
+		}
+
+		nq.Vars = append(nq.Vars, qv)
+	}
+
+	return nq
+}
+
+// QueryFields compiles the named query for the role and returns
+// the fields of the json result
+func (gj *GraphJin) QueryFields(name, role string) ([]QueryField, error) {
+	var vm map[string]json.RawMessage
+
+	nq, ok := gj.namedQueries()[name]
+	if !ok {
+		return nil, fmt.Errorf("query not found in allow list: %s", name)
+	}
+
+	if len(nq.vars) != 0 {
+		if err := json.Unmarshal(nq.vars, &vm); err != nil {
+			return nil, fmt.Errorf("variables: %w", err)
+		}
+	}
+
+	qc, err := gj.qc.Compile([]byte(nq.Query), vm, role)
+	if err != nil {
+		return nil, err
+	}
+
+	return selectFields(qc, qc.Roots), nil
+}
+
+func selectFields(qc *qcode.QCode, ids []int32) []QueryField {
+	var fields []QueryField
+
+	for _, id := range ids {
+		sel := &qc.Selects[id]
+
+		if sel.SkipRender == qcode.SkipTypeUserNeeded {
+			continue
+		}
+
+		f := QueryField{
+			Name: sel.FieldName,
+			List: !sel.Singular,
+		}
+
+		if sel.Typename {
+			f.Fields = append(f.Fields,
+				QueryField{Name: "__typename", Type: "text", NotNull: true})
+		}
+
+		for _, c := range sel.Cols {
+			f.Fields = append(f.Fields, QueryField{
+				Name:    c.FieldName,
+				Type:    c.Col.Type,
+				Array:   c.Col.Array,
+				NotNull: c.Col.NotNull,
+			})
+		}
+
+		for _, fn := range sel.Funcs {
+			f.Fields = append(f.Fields, QueryField{
+				Name: fn.FieldName,
+				Type: funcType(fn),
+			})
+		}
+
+		f.Fields = append(f.Fields, selectFields(qc, sel.Children)...)
+		fields = append(fields, f)
+
+		if sel.Paging.Cursor {
+			fields = append(fields, QueryField{Name: sel.FieldName + "_cursor", Type: "text"})
+		}
+	}
+
+	return fields
+}
+
+func funcType(fn qcode.Function) string {
+	switch fn.Name {
+	case "count":
+		return "bigint"
+	case "min", "max":
+		return fn.Col.Type
+	case "search_rank":
+		return "real"
+	case "search_headline":
+		return "text"
+	default:
+		return "numeric"
+	}
+}
@@ -3,7 +3,11 @@ package core_test
 import (
 	"context"
 	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
 	"testing"
+	"time"
 
 	"github.com/dosco/graphjin/core"
 	"github.com/stretchr/testify/assert"
@@ -11,6 +15,7 @@ import (
 
 func TestQuery(t *testing.T) {
 	t.Run("queryWithVariableLimit", queryWithVariableLimit)
+	t.Run("namedQuerySavedInDev", namedQuerySavedInDev)
 }
 
 func queryWithVariableLimit(t *testing.T) {
@@ -41,3 +46,44 @@ func queryWithVariableLimit(t *testing.T) {
 		assert.Equal(t, got, exp, "should equal")
 	}
 }
+
+func namedQuerySavedInDev(t *testing.T) {
+	gql := `query getProductNames {
+		products(limit: 2) {
+			name
+		}
+	}`
+
+	dir, err := ioutil.TempDir("", "allow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &core.Config{
+		DBType:        dbType,
+		AllowListFile: path.Join(dir, "allow.list"),
+	}
+	gj, err := core.NewGraphJin(conf, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := gj.NamedQuery("getProductNames"); ok {
+		t.Fatal("query should not be in the allow list before it's run")
+	}
+
+	if _, err := gj.GraphQL(context.Background(), gql, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the allow list is saved in the background
+	for i := 0; i < 20; i++ {
+		if _, ok := gj.NamedQuery("getProductNames"); ok {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	t.Fatal("query saved in dev mode should be returned without a restart")
+}
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// mergeRoles adds the tables of the roles listed in extends to the role. A table
+// defined in both takes each operation the role does not define from the parent,
+// with several parents the later ones take precedence.
+func mergeRoles(c *Config) error {
+	rm := make(map[string]*Role, len(c.Roles))
+
+	for i := range c.Roles {
+		rm[strings.ToLower(c.Roles[i].Name)] = &c.Roles[i]
+	}
+
+	done := make(map[string]bool)
+
+	var merge func(r *Role, path []string) error
+
+	merge = func(r *Role, path []string) error {
+		k := strings.ToLower(r.Name)
+
+		if done[k] {
+			return nil
+		}
+
+		for _, v := range path {
+			if v == k {
+				return fmt.Errorf("roles: extends cycle found: %s -> %s",
+					strings.Join(path, " -> "), r.Name)
+			}
+		}
+		path = append(path, k)
+
+		tables := make([]RoleTable, 0, len(r.Tables))
+
+		for _, pn := range r.Extends {
+			p, ok := rm[strings.ToLower(pn)]
+			if !ok {
+				// user and anon roles are added when not defined
+				if pn == "user" || pn == "anon" {
+					continue
+				}
+				return fmt.Errorf("roles: %s: extends unknown role: %s", r.Name, pn)
+			}
+
+			if err := merge(p, path); err != nil {
+				return err
+			}
+
+			for _, t := range p.Tables {
+				tables = mergeRoleTable(tables, t)
+			}
+		}
+
+		for _, t := range r.Tables {
+			tables = mergeRoleTable(tables, t)
+		}
+
+		r.Tables = tables
+		done[k] = true
+
+		return nil
+	}
+
+	for i := range c.Roles {
+		if err := merge(&c.Roles[i], nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeRoleTable adds the table to the list, the operations
+// defined by the table replace the ones already in the list
+func mergeRoleTable(tables []RoleTable, t RoleTable) []RoleTable {
+	for i := range tables {
+		t1 := &tables[i]
+
+		if !strings.EqualFold(t1.Name, t.Name) || t1.Schema != t.Schema {
+			continue
+		}
+
+		if t.ReadOnly {
+			t1.ReadOnly = true
+		}
+		if t.Query != nil {
+			t1.Query = t.Query
+		}
+		if t.Insert != nil {
+			t1.Insert = t.Insert
+		}
+		if t.Update != nil {
+			t1.Update = t.Update
+		}
+		if t.Upsert != nil {
+			t1.Upsert = t.Upsert
+		}
+		if t.Delete != nil {
+			t1.Delete = t.Delete
+		}
+		return tables
+	}
+
+	return append(tables, t)
+}
+
+// UserRole returns the role of the user of the request the same way it's resolved
+// for queries, with attribute based access control the roles query is run to
+// find it. Multiple roles are returned as a comma separated list.
+func (gj *GraphJin) UserRole(c context.Context) (string, error) {
+	role, _, err := gj.subRole(c, nil)
+	return role, err
+}
+
+// activeRoles limits the role to the active roles picked for the request and
+// returns the roles as a comma separated list in the order they are defined in
+// the config. The role itself can be a list of roles when multiple_roles is set.
+func (gj *GraphJin) activeRoles(role string, active []string) (string, error) {
+	if len(active) == 0 && strings.IndexByte(role, ',') == -1 {
+		return role, nil
+	}
+
+	// roles are matched in lowercase like the keys of gj.roles
+	rm := make(map[string]bool)
+
+	for _, r := range strings.Split(role, ",") {
+		k := strings.ToLower(strings.TrimSpace(r))
+		if _, ok := gj.roles[k]; !ok {
+			return "", fmt.Errorf("role not defined: %s", r)
+		}
+		rm[k] = true
+	}
+
+	if len(active) != 0 {
+		am := make(map[string]bool, len(active))
+
+		for _, r := range active {
+			k := strings.ToLower(strings.TrimSpace(r))
+			if !rm[k] {
+				return "", fmt.Errorf("role not allowed: %s", r)
+			}
+			am[k] = true
+		}
+		rm = am
+	}
+
+	var roles []string
+
+	for _, r := range gj.conf.Roles {
+		if rm[strings.ToLower(r.Name)] {
+			roles = append(roles, r.Name)
+		}
+	}
+
+	return strings.Join(roles, ","), nil
+}
+
+// dbRole returns the database role for the role, for a list
+// of roles it's the database role of the first one that has one
+func (gj *GraphJin) dbRole(role string) string {
+	for _, r := range strings.Split(role, ",") {
+		if ro, ok := gj.roles[strings.ToLower(r)]; ok && ro.DBRole != "" {
+			return ro.DBRole
+		}
+	}
+	return ""
+}
+
+func (rc *ReqConfig) activeRoles() []string {
+	if rc == nil {
+		return nil
+	}
+	return rc.Roles
+}
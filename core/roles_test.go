@@ -0,0 +1,71 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeRoles(t *testing.T) {
+	c := &Config{Roles: []Role{
+		{Name: "editor", Extends: []string{"user"}, Tables: []RoleTable{
+			{Name: "posts", Update: &Update{Columns: []string{"body"}}},
+		}},
+		{Name: "user", Tables: []RoleTable{
+			{Name: "posts", Query: &Query{Limit: 10}, Update: &Update{Block: true}},
+			{Name: "users", Query: &Query{Columns: []string{"id"}}},
+		}},
+	}}
+
+	if err := mergeRoles(c); err != nil {
+		t.Fatal(err)
+	}
+
+	tables := c.Roles[0].Tables
+	if len(tables) != 2 {
+		t.Fatalf("expected 2 tables got %d", len(tables))
+	}
+
+	if tables[0].Query == nil || tables[0].Query.Limit != 10 {
+		t.Error("expected the query config to be inherited")
+	}
+
+	if tables[0].Update.Block || tables[0].Update.Columns[0] != "body" {
+		t.Error("expected the update config to be overridden")
+	}
+
+	c.Roles[1].Extends = []string{"editor"}
+
+	if err := mergeRoles(c); err == nil {
+		t.Error("expected an error for the extends cycle")
+	}
+}
+
+func TestActiveRoles(t *testing.T) {
+	gj := &GraphJin{conf: &Config{Roles: []Role{
+		{Name: "editor"}, {Name: "Billing_Admin"}, {Name: "user"},
+	}}}
+
+	gj.roles = make(map[string]*Role)
+	for i, r := range gj.conf.Roles {
+		gj.roles[strings.ToLower(r.Name)] = &gj.conf.Roles[i]
+	}
+
+	// roles match in any case and are returned as named in the config
+	role, err := gj.activeRoles("billing_admin,editor", nil)
+	if err != nil || role != "editor,Billing_Admin" {
+		t.Errorf("expected 'editor,Billing_Admin' got '%s' (%v)", role, err)
+	}
+
+	role, err = gj.activeRoles("Editor,billing_admin", []string{"BILLING_ADMIN"})
+	if err != nil || role != "Billing_Admin" {
+		t.Errorf("expected 'Billing_Admin' got '%s' (%v)", role, err)
+	}
+
+	if _, err := gj.activeRoles("editor", []string{"billing_admin"}); err == nil {
+		t.Error("expected an error for a role the user does not have")
+	}
+
+	if _, err := gj.activeRoles("editor,admin", nil); err == nil {
+		t.Error("expected an error for an undefined role")
+	}
+}
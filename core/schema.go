@@ -0,0 +1,84 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/dosco/graphjin/core/internal/sdata"
+)
+
+// schemaSnapshot is the json format of a saved database schema
+type schemaSnapshot struct {
+	Type      string
+	Version   string
+	Columns   []sdata.DBColumn
+	Functions []sdata.DBFunction
+}
+
+// DumpSchema reads the schema of the database and returns it as json. The snapshot
+// can be used with NewGraphJinWithSchema to compile queries without a database.
+func DumpSchema(conf *Config, db *sql.DB) ([]byte, error) {
+	var version string
+
+	ss := schemaSnapshot{Type: conf.DBType}
+
+	if ss.Type == "" {
+		ss.Type = "postgres"
+	}
+
+	if ss.Type != "mysql" {
+		_ = db.QueryRow(`SHOW server_version_num`).Scan(&version)
+	}
+	ss.Version = version
+
+	cols, err := sdata.DiscoverColumns(db, ss.Type, conf.Blocklist)
+	if err != nil {
+		return nil, err
+	}
+	ss.Columns = cols
+
+	if ss.Type != "mysql" {
+		if ss.Functions, err = sdata.DiscoverFunctions(db, conf.Blocklist); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.MarshalIndent(ss, "", "  ")
+}
+
+// NewGraphJinWithSchema creates the GraphJin struct using a schema snapshot saved
+// with DumpSchema instead of querying the database. Queries can be compiled
+// but since there is no database connection they cannot be run.
+func NewGraphJinWithSchema(conf *Config, schema []byte) (*GraphJin, error) {
+	var ss schemaSnapshot
+
+	if err := json.Unmarshal(schema, &ss); err != nil {
+		return nil, fmt.Errorf("schema snapshot: %w", err)
+	}
+
+	if len(ss.Columns) == 0 {
+		return nil, fmt.Errorf("schema snapshot: no columns found")
+	}
+
+	if ss.Version != "" {
+		if _, err := strconv.Atoi(ss.Version); err != nil {
+			return nil, fmt.Errorf("schema snapshot: invalid version: %s", ss.Version)
+		}
+	}
+
+	var blocklist []string
+
+	if conf != nil {
+		blocklist = conf.Blocklist
+
+		if conf.DBType == "" {
+			conf.DBType = ss.Type
+		}
+	}
+
+	dbinfo := sdata.NewDBInfo(ss.Type, ss.Version, ss.Columns, ss.Functions, blocklist)
+
+	return newGraphJin(conf, nil, dbinfo)
+}
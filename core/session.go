@@ -0,0 +1,128 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dosco/graphjin/core/internal/psql"
+)
+
+// needsSession returns true when the query has to run in a transaction
+// that sets the session settings or the database role
+func (gj *GraphJin) needsSession(role string) bool {
+	if gj.conf.SetUserID || len(gj.conf.SessionSettings) != 0 {
+		return true
+	}
+	return gj.dbRole(role) != ""
+}
+
+// setSession sets the user id, the session settings and the database role for
+// the role as transaction local settings so they are reset when the transaction
+// ends and the connection goes back to the pool.
+func (gj *GraphJin) setSession(c context.Context, tx *sql.Tx, role string, rc *ReqConfig) error {
+	settings := make(map[string]string, len(gj.conf.SessionSettings)+1)
+
+	if gj.conf.SetUserID {
+		if v, ok := userIDValue(c); ok {
+			settings["user.id"] = v
+		}
+	}
+
+	for k, v := range gj.conf.SessionSettings {
+		v1, ok, err := sessionValue(c, v, role, rc)
+		if err != nil {
+			return fmt.Errorf("session_settings: %s: %w", k, err)
+		}
+		if ok {
+			settings[k] = v1
+		}
+	}
+
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if _, err := tx.ExecContext(c, `SELECT set_config($1, $2, true)`, k, settings[k]); err != nil {
+			return err
+		}
+	}
+
+	if dr := gj.dbRole(role); dr != "" {
+		q := `SET LOCAL ROLE "` + strings.ReplaceAll(dr, `"`, `""`) + `"`
+		if _, err := tx.ExecContext(c, q); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sessionValue resolves a session setting value, variables that are
+// not set return false and the setting is skipped
+func sessionValue(c context.Context, v, role string, rc *ReqConfig) (string, bool, error) {
+	if len(v) < 2 || v[0] != '$' {
+		return v, true, nil
+	}
+	name := v[1:]
+
+	switch {
+	case name == "user_id":
+		v, ok := userIDValue(c)
+		return v, ok, nil
+
+	case name == "user_id_provider":
+		v, ok := c.Value(UserIDProviderKey).(string)
+		return v, ok, nil
+
+	case name == "user_role":
+		return role, true, nil
+
+	case name == "jwt":
+		claims, ok := c.Value(UserClaimsKey).(map[string]interface{})
+		if !ok {
+			return "", false, nil
+		}
+		b, err := json.Marshal(claims)
+		return string(b), true, err
+
+	case strings.HasPrefix(name, "jwt."):
+		v, err := claimArg(c, psql.Param{Name: name, Type: "text"})
+		if err != nil {
+			return "", false, nil
+		}
+		switch v1 := v.(type) {
+		case string:
+			return v1, true, nil
+		case json.RawMessage:
+			return string(v1), true, nil
+		default:
+			return fmt.Sprintf("%v", v1), true, nil
+		}
+	}
+
+	if rc != nil {
+		if fn, ok := rc.Vars[name].(func() string); ok {
+			return fn(), true, nil
+		}
+	}
+
+	return "", false, nil
+}
+
+func userIDValue(c context.Context) (string, bool) {
+	switch v := c.Value(UserIDKey).(type) {
+	case string:
+		return v, true
+	case int:
+		return strconv.Itoa(v), true
+	}
+	return "", false
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSessionValue(t *testing.T) {
+	c := context.WithValue(context.Background(), UserIDKey, 5)
+	c = context.WithValue(c, UserClaimsKey, map[string]interface{}{
+		"org": map[string]interface{}{"id": float64(7)},
+	})
+
+	rc := &ReqConfig{Vars: map[string]interface{}{
+		"region": func() string { return "eu" },
+	}}
+
+	tests := []struct {
+		v   string
+		exp string
+		ok  bool
+	}{
+		{"public", "public", true},
+		{"$user_id", "5", true},
+		{"$user_role", "editor", true},
+		{"$user_id_provider", "", false},
+		{"$jwt", `{"org":{"id":7}}`, true},
+		{"$jwt.org.id", "7", true},
+		{"$jwt.missing", "", false},
+		{"$region", "eu", true},
+		{"$unknown", "", false},
+	}
+
+	for _, v := range tests {
+		val, ok, err := sessionValue(c, v.v, "editor", rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if val != v.exp || ok != v.ok {
+			t.Errorf("%s: expected '%s' (%t) got '%s' (%t)", v.v, v.exp, v.ok, val, ok)
+		}
+	}
+}
+
+func TestNeedsSession(t *testing.T) {
+	gj := &GraphJin{conf: &Config{}, roles: map[string]*Role{
+		"user":   {Name: "user"},
+		"editor": {Name: "editor", DBRole: "app_editor"},
+	}}
+
+	if gj.needsSession("user") {
+		t.Error("expected no session for a role without a database role")
+	}
+
+	if !gj.needsSession("user,editor") || gj.dbRole("user,editor") != "app_editor" {
+		t.Errorf("expected the database role 'app_editor' got '%s'", gj.dbRole("user,editor"))
+	}
+
+	gj.conf.SetUserID = true
+
+	if !gj.needsSession("user") {
+		t.Error("expected a session when the user id is set")
+	}
+}
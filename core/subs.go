@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dosco/graphjin/core/internal/qcode"
@@ -28,9 +29,15 @@ type sub struct {
 	q    *cquery
 
 	add  chan *Member
-	del  chan *Member
+	del  chan xid.ID
 	updt chan mmsg
 
+	// closed when the subscription controller exits
+	done chan struct{}
+
+	// set while the roles of the subscribers are being checked
+	checking int32
+
 	mval
 	sync.Once
 }
@@ -47,6 +54,24 @@ type minfo struct {
 	values []interface{}
 	// index of cursor value in the arguments array
 	cindx int
+	// user context used to re-evaluate the role and to set the session
+	// settings, nil when neither of them is needed
+	uctx context.Context
+	// the role must be re-evaluated
+	recheck bool
+	// request config of the subscriber
+	rc *ReqConfig
+	// closed when the member is removed
+	end chan struct{}
+}
+
+// rcheck is a copy of a subscriber whose role is re-evaluated,
+// it's safe to use outside the subscription controller
+type rcheck struct {
+	id   xid.ID
+	res  chan *Result
+	uctx context.Context
+	rc   *ReqConfig
 }
 
 type mmsg struct {
@@ -61,8 +86,18 @@ type Member struct {
 	done   bool
 	id     xid.ID
 	vl     []interface{}
+	// closed on unsubscribe
+	quit chan struct{}
+	// closed when the subscription ends for the member
+	end chan struct{}
+	// the member is resuming from a cursor, it's removed from
+	// the subscription by resumeSub instead of Unsubscribe
+	resuming bool
 	// index of cursor value in the arguments array
-	cindx int
+	cindx   int
+	uctx    context.Context
+	recheck bool
+	rc      *ReqConfig
 }
 
 func (gj *GraphJin) Subscribe(c context.Context, query string, vars json.RawMessage) (*Member, error) {
@@ -92,20 +127,18 @@ func (gj *GraphJin) SubscribeEx(
 		}
 	}
 
-	var role string
-
-	if v := c.Value(UserIDKey); v != nil {
-		role = "user"
-	} else {
-		role = "anon"
+	role, recheck, err := gj.subRole(c, rc)
+	if err != nil {
+		return nil, err
 	}
 
 	v, _ := gj.subs.LoadOrStore((name + role), &sub{
 		name: name,
 		role: role,
 		add:  make(chan *Member),
-		del:  make(chan *Member),
+		del:  make(chan xid.ID),
 		updt: make(chan mmsg, 10),
+		done: make(chan struct{}),
 	})
 	s := v.(*sub)
 
@@ -125,15 +158,213 @@ func (gj *GraphJin) SubscribeEx(
 
 	m := &Member{
 		Result: make(chan *Result, 10),
+		id:     xid.New(),
+		quit:   make(chan struct{}),
+		end:    make(chan struct{}),
 		sub:    s,
 		vl:     args.values,
 		cindx:  args.cindx,
 	}
-	s.add <- m
+
+	// the session settings are set for each subscriber
+	if recheck || gj.needsSession(role) {
+		m.uctx = userContext(c)
+		m.recheck = recheck
+		m.rc = rc
+	}
+
+	// the client is resuming the subscription using the
+	// cursor from the last update it received
+	if m.cindx != -1 && m.vl[m.cindx] != nil {
+		m.resuming = true
+		go gj.resumeSub(c, s, m, rc)
+		return m, nil
+	}
+
+	select {
+	case s.add <- m:
+	case <-s.done:
+		return nil, errors.New("subscription: closed")
+	}
 
 	return m, nil
 }
 
+// resumeSub delivers all the rows after the cursor that the subscription is
+// resumed from and then adds the member to the subscription for live updates.
+// Only the first 'subs_catch_up_pages' pages are delivered right away,
+// the rest follow as regular updates.
+func (gj *GraphJin) resumeSub(c context.Context, s *sub, m *Member, rc *ReqConfig) {
+	maxPages := 100
+	if gj.conf.SubsCatchUpPages != 0 {
+		maxPages = gj.conf.SubsCatchUpPages
+	}
+
+	for i := 0; i < maxPages; i++ {
+		params, err := json.Marshal(m.vl)
+		if err != nil {
+			gj.log.Printf("Subscription Error: %s", err)
+			break
+		}
+
+		js, err := gj.subQuery(c, s, rc, params)
+		if err != nil {
+			gj.log.Printf("Subscription Error: %s", err)
+			break
+		}
+
+		cur, err := gj.encryptCursor(s.q.st.qc, js)
+		if err != nil {
+			gj.log.Printf("Subscription Error: %s", err)
+			break
+		}
+
+		// no cursor means no more rows, the client
+		// has caught up
+		if cur.value == "" {
+			break
+		}
+
+		res := &Result{
+			op:   qcode.QTQuery,
+			name: s.name,
+			sql:  s.q.st.sql,
+			role: s.q.st.role.Name,
+			Data: cur.data,
+		}
+
+		select {
+		case m.Result <- res:
+		case <-m.quit:
+			close(m.end)
+			return
+		}
+		m.vl[m.cindx] = cur.value
+	}
+
+	select {
+	case s.add <- m:
+	case <-m.quit:
+		close(m.end)
+		return
+	case <-s.done:
+		res := &Result{
+			op:    qcode.QTQuery,
+			name:  s.name,
+			role:  s.role,
+			Error: "subscription: closed, please subscribe again",
+		}
+		select {
+		case m.Result <- res:
+		case <-m.quit:
+		}
+		close(m.end)
+		return
+	}
+
+	// the member is only removed once the controller has added it
+	select {
+	case <-m.quit:
+		select {
+		case s.del <- m.id:
+		case <-s.done:
+		}
+	case <-m.end:
+	}
+}
+
+// subQuery runs the subscription query for a single subscriber in the same way as
+// queries are run, with the session settings of the subscriber when needed.
+func (gj *GraphJin) subQuery(c context.Context, s *sub, rc *ReqConfig, params json.RawMessage) (json.RawMessage, error) {
+	var js json.RawMessage
+
+	conn, err := gj.db.Conn(c)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var row *sql.Row
+	var args []interface{}
+
+	if len(s.q.st.md.Params()) != 0 {
+		args = []interface{}{renderJSONArray([]json.RawMessage{params})}
+	}
+
+	if gj.needsSession(s.role) {
+		ct := scontext{Context: c, gj: gj, op: qcode.QTSubscription, name: s.name, rc: rc}
+
+		tx, err := ct.beginTx(conn, s.role, false)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback() //nolint: errcheck
+
+		row = tx.QueryRowContext(c, s.q.st.sql, args...)
+	} else {
+		row = conn.QueryRowContext(c, s.q.st.sql, args...)
+	}
+
+	err = row.Scan(&js)
+	return js, err
+}
+
+// subRole resolves the role for a subscriber the same way as it's done
+// for queries and mutations. Since subscriptions are shared by all
+// subscribers with the same role, with attribute based access control
+// the roles query is executed upfront and the role must be re-evaluated
+// from time to time.
+func (gj *GraphJin) subRole(c context.Context, rc *ReqConfig) (string, bool, error) {
+	var role string
+	var recheck bool
+	var err error
+
+	switch {
+	case c.Value(UserRoleKey) != nil:
+		role = c.Value(UserRoleKey).(string)
+
+	case !keyExists(c, UserIDKey):
+		role = "anon"
+
+	case !gj.abacEnabled:
+		role = "user"
+
+	default:
+		if role, err = gj.queryRole(c, rc); err != nil {
+			return "", false, err
+		}
+		recheck = true
+	}
+
+	role, err = gj.activeRoles(role, rc.activeRoles())
+	return role, recheck, err
+}
+
+func (gj *GraphJin) queryRole(c context.Context, rc *ReqConfig) (string, error) {
+	conn, err := gj.db.Conn(c)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	ct := scontext{Context: c, gj: gj, op: qcode.QTSubscription, rc: rc}
+	return ct.executeRoleQuery(conn)
+}
+
+// userContext copies the user values from the request context into a new
+// context that is not cancelled when the request ends. The claims are
+// needed by roles queries that use $jwt variables.
+func userContext(c context.Context) context.Context {
+	uc := context.Background()
+
+	for _, k := range []contextkey{UserIDProviderKey, UserIDKey, UserClaimsKey, UserRoleKey} {
+		if v := c.Value(k); v != nil {
+			uc = context.WithValue(uc, k, v)
+		}
+	}
+	return uc
+}
+
 func (gj *GraphJin) newSub(c context.Context, s *sub, query string, vars json.RawMessage) error {
 	rq := rquery{
 		op:    qcode.QTSubscription,
@@ -156,7 +387,15 @@ func (gj *GraphJin) newSub(c context.Context, s *sub, query string, vars json.Ra
 }
 
 func (gj *GraphJin) subController(s *sub) {
+	defer close(s.done)
 	defer gj.subs.Delete((s.name + s.role))
+
+	// the subscription has ended for the remaining members
+	defer func() {
+		for i := range s.mi {
+			close(s.mi[i].end)
+		}
+	}()
 	var ps time.Duration
 
 	if gj.conf.PollDuration != 0 {
@@ -165,16 +404,32 @@ func (gj *GraphJin) subController(s *sub) {
 		ps = 5 * time.Second
 	}
 
+	// with attribute based access control the role of each
+	// subscriber is periodically re-evaluated
+	var roleCheck <-chan time.Time
+
+	if gj.abacEnabled {
+		rs := 60 * time.Second
+		if gj.conf.RoleCheckDuration != 0 {
+			rs = gj.conf.RoleCheckDuration * time.Second
+		}
+
+		t := time.NewTicker(rs)
+		defer t.Stop()
+		roleCheck = t.C
+	}
+
 	for {
 		select {
 		case m := <-s.add:
 			if err := s.addMember(m); err != nil {
 				gj.log.Printf("Subscription Error: %s", err)
+				close(m.end)
 				return
 			}
 
-		case m := <-s.del:
-			s.deleteMember(m)
+		case id := <-s.del:
+			s.deleteMember(id)
 			if len(s.ids) == 0 {
 				return
 			}
@@ -185,6 +440,12 @@ func (gj *GraphJin) subController(s *sub) {
 				return
 			}
 
+		case <-roleCheck:
+			// skip the check while the previous one is still running
+			if atomic.CompareAndSwapInt32(&s.checking, 0, 1) {
+				go gj.checkRoles(s, s.roleChecks())
+			}
+
 		case <-time.After(ps):
 			s.fanOutJobs(gj)
 		}
@@ -197,8 +458,7 @@ func (s *sub) addMember(m *Member) error {
 		return err
 	}
 
-	m.id = xid.New()
-	mi := minfo{cindx: m.cindx}
+	mi := minfo{cindx: m.cindx, uctx: m.uctx, recheck: m.recheck, rc: m.rc, end: m.end}
 	if mi.cindx != -1 {
 		mi.values = m.vl
 	}
@@ -210,11 +470,12 @@ func (s *sub) addMember(m *Member) error {
 	return nil
 }
 
-func (s *sub) deleteMember(m *Member) {
-	i, ok := s.findByID(m.id)
+func (s *sub) deleteMember(id xid.ID) {
+	i, ok := s.findByID(id)
 	if !ok {
 		return
 	}
+	close(s.mi[i].end)
 
 	s.params[i] = s.params[len(s.params)-1]
 	s.params = s.params[:len(s.params)-1]
@@ -283,6 +544,23 @@ func (gj *GraphJin) checkUpdates(s *sub, mv mval, start int) {
 		end = start + (len(mv.ids) - start)
 	}
 
+	// the session settings can differ for each subscriber
+	// so each of them is queried on its own
+	if gj.needsSession(s.role) {
+		for j := start; j < end; j++ {
+			js, err := gj.subQuery(mv.mi[j].uctx, s, mv.mi[j].rc, mv.params[j])
+			if err != nil {
+				gj.log.Printf("Subscription Error: %s", err)
+				continue
+			}
+
+			if !gj.notifyMembers(s, mv, j, mv.res[j:j+1], js) {
+				return
+			}
+		}
+		return
+	}
+
 	var rows *sql.Rows
 	var err error
 
@@ -303,6 +581,7 @@ func (gj *GraphJin) checkUpdates(s *sub, mv mval, start int) {
 		gj.log.Printf("Subscription Error: %s", err)
 		return
 	}
+	defer rows.Close()
 
 	var js json.RawMessage
 	i := 0
@@ -315,53 +594,125 @@ func (gj *GraphJin) checkUpdates(s *sub, mv mval, start int) {
 		j := start + i
 		i++
 
-		newDH := sha256.Sum256(js)
-		if mv.mi[j].dh == newDH {
+		// if parameters exists then each response is unique
+		// so each channel should be notified only with it's own
+		// result value
+		res := mv.res[j : j+1]
+
+		// if no params exist then it means we are not using
+		// the joined query so we are expecting only a single
+		// result, so we can optimize here by notifying
+		// all channels since there will only be one result
+		if !hasParams {
+			res = mv.res[start:end]
+		}
+
+		if !gj.notifyMembers(s, mv, j, res, js) {
+			return
+		}
+	}
+}
+
+// notifyMembers sends the result of the subscriber j to the result channels
+// when it has changed, false is returned when the subscription has ended.
+func (gj *GraphJin) notifyMembers(s *sub, mv mval, j int, res []chan *Result, js json.RawMessage) bool {
+	newDH := sha256.Sum256(js)
+	if mv.mi[j].dh == newDH {
+		return true
+	}
+
+	cur, err := gj.encryptCursor(s.q.st.qc, js)
+	if err != nil {
+		gj.log.Printf("Subscription Error: %s", err)
+		return false
+	}
+
+	// we're expecting a cursor but the cursor was null
+	// so we skip this one.
+	if mv.mi[j].cindx != -1 && cur.value == "" {
+		return true
+	}
+
+	select {
+	case s.updt <- mmsg{id: mv.ids[j], dh: newDH, cursor: cur.value}:
+	case <-s.done:
+		return false
+	}
+
+	r := &Result{
+		op:   qcode.QTQuery,
+		name: s.name,
+		sql:  s.q.st.sql,
+		role: s.q.st.role.Name,
+		Data: cur.data,
+	}
+
+	for _, ch := range res {
+		select {
+		case ch <- r:
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+	return true
+}
+
+// roleChecks returns a copy of the subscribers whose role must be
+// re-evaluated since members can be removed while it's being done.
+func (s *sub) roleChecks() []rcheck {
+	var rl []rcheck
+
+	for i := range s.mi {
+		if !s.mi[i].recheck {
 			continue
 		}
+		rl = append(rl, rcheck{
+			id:   s.ids[i],
+			res:  s.res[i],
+			uctx: s.mi[i].uctx,
+			rc:   s.mi[i].rc,
+		})
+	}
+	return rl
+}
 
-		cur, err := gj.encryptCursor(s.q.st.qc, js)
+// checkRoles re-evaluates the role of each subscriber and removes the
+// ones whose role no longer matches the role of the subscription.
+func (gj *GraphJin) checkRoles(s *sub, rl []rcheck) {
+	defer atomic.StoreInt32(&s.checking, 0)
+
+	for _, m := range rl {
+		role, err := gj.queryRole(m.uctx, m.rc)
 		if err != nil {
 			gj.log.Printf("Subscription Error: %s", err)
-			return
+			continue
 		}
 
-		// we're expecting a cursor but the cursor was null
-		// so we skip this one.
-		if mv.mi[j].cindx != -1 && cur.value == "" {
-			continue
+		// an error means the user no longer has one of the active
+		// roles so the role is treated as changed
+		if r, err := gj.activeRoles(role, m.rc.activeRoles()); err == nil {
+			role = r
 		}
 
-		s.updt <- mmsg{id: mv.ids[j], dh: newDH, cursor: cur.value}
+		if role == s.role {
+			continue
+		}
 
 		res := &Result{
-			op:   qcode.QTQuery,
-			name: s.name,
-			sql:  s.q.st.sql,
-			role: s.q.st.role.Name,
-			Data: cur.data,
+			op:    qcode.QTQuery,
+			name:  s.name,
+			role:  role,
+			Error: "subscription: role changed, please subscribe again",
 		}
 
-		// if parameters exists then each response is unique
-		// so each channel should be notified only with it's own
-		// result value
-		if hasParams {
-			select {
-			case mv.res[j] <- res:
-			case <-time.After(250 * time.Millisecond):
-			}
-		} else {
+		select {
+		case m.res <- res:
+		case <-time.After(250 * time.Millisecond):
+		}
 
-			// if no params exist then it means we are not using
-			// the joined query so we are expecting only a single
-			// result, so we can optimize here by notifying
-			// all channels since there will only be one result
-			for k := start; k < end; k++ {
-				select {
-				case mv.res[k] <- res:
-				case <-time.After(250 * time.Millisecond):
-				}
-			}
+		select {
+		case s.del <- m.id:
+		case <-s.done:
+			return
 		}
 	}
 }
@@ -429,11 +780,28 @@ func (s *sub) findByID(id xid.ID) (int, bool) {
 
 func (m *Member) Unsubscribe() {
 	if m != nil && !m.done {
-		m.sub.del <- m
+		close(m.quit)
 		m.done = true
+
+		if m.resuming {
+			return
+		}
+
+		select {
+		case m.sub.del <- m.id:
+		case <-m.sub.done:
+		}
 	}
 }
 
+// Done returns a channel that is closed when the subscription ends for the
+// member, either on unsubscribe or when it's ended by GraphJin like when
+// the role of the user changes. Results sent before it ends can still
+// be read from the result channel.
+func (m *Member) Done() <-chan struct{} {
+	return m.end
+}
+
 func (m *Member) String() string {
 	return m.id.String()
 }
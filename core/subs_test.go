@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/dosco/graphjin/core"
 )
@@ -97,3 +99,277 @@ func TestSubscription(t *testing.T) {
 
 	w.Wait()
 }
+
+func TestSubscriptionRoles(t *testing.T) {
+	gql := `subscription test {
+		user(id: $id) {
+			id
+			email
+		}
+	}`
+
+	conf := &core.Config{DBType: dbType, DisableAllowList: true, PollDuration: 1, RoleCheckDuration: 1}
+	conf.RolesQuery = `SELECT * FROM users WHERE id = $user_id`
+	conf.Roles = []core.Role{{Name: "disabled_user", Match: "disabled = true"}}
+
+	err := conf.AddRoleTable("disabled_user", "users", core.Query{Block: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gj, err := core.NewGraphJin(conf, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subscribe := func(userID int) *core.Member {
+		c := context.WithValue(context.Background(), core.UserIDKey, userID)
+		vars := json.RawMessage(fmt.Sprintf(`{ "id": %d }`, userID))
+
+		m, err := gj.Subscribe(c, gql, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	// user 50 is disabled
+	m1 := subscribe(50)
+	defer m1.Unsubscribe()
+
+	if msg := <-m1.Result; msg.Role() != "disabled_user" {
+		t.Errorf("expected role 'disabled_user' got '%s'", msg.Role())
+	}
+
+	m2 := subscribe(60)
+	defer m2.Unsubscribe()
+
+	if msg := <-m2.Result; msg.Role() != "user" {
+		t.Errorf("expected role 'user' got '%s'", msg.Role())
+	}
+
+	if _, err := db.Exec(`UPDATE users SET disabled = true WHERE id = 60`); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(`UPDATE users SET disabled = false WHERE id = 60`) //nolint: errcheck
+
+	// the subscription ends once the new role is found by the role check
+	timeout := time.After(10 * time.Second)
+	var roleChanged bool
+
+	isRoleChanged := func(msg *core.Result) {
+		if strings.Contains(msg.Error, "role changed") {
+			roleChanged = true
+		}
+	}
+
+loop:
+	for {
+		select {
+		case msg := <-m2.Result:
+			isRoleChanged(msg)
+
+		case <-m2.Done():
+			break loop
+
+		case <-timeout:
+			t.Fatal("expected the subscription to end when the role changed")
+		}
+	}
+
+	// results sent before the end can still be read
+	for len(m2.Result) != 0 {
+		isRoleChanged(<-m2.Result)
+	}
+
+	if !roleChanged {
+		t.Error("expected a role changed error")
+	}
+}
+
+func TestSubscriptionSetUserID(t *testing.T) {
+	gql := `subscription test {
+		user(id: $id) {
+			id
+			email
+		}
+	}`
+
+	conf := &core.Config{DBType: dbType, DisableAllowList: true, PollDuration: 1, SetUserID: true}
+	conf.RolesQuery = `SELECT * FROM users WHERE id = $user_id`
+
+	// the user.id setting is set for the roles query
+	conf.Roles = []core.Role{{Name: "owner", Match: "id::text = current_setting('user.id', true)"}}
+
+	err := conf.AddRoleTable("owner", "users", core.Query{Columns: []string{"id", "email"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gj, err := core.NewGraphJin(conf, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []int{90, 91} {
+		c := context.WithValue(context.Background(), core.UserIDKey, id)
+		vars := json.RawMessage(fmt.Sprintf(`{ "id": %d }`, id))
+
+		m, err := gj.Subscribe(c, gql, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer m.Unsubscribe()
+
+		// each subscriber is queried with its own user id set
+		select {
+		case msg := <-m.Result:
+			exp := fmt.Sprintf(`{"user": {"id": %d, "email": "user%d@test.com"}}`, id, id)
+
+			if msg.Role() != "owner" || string(msg.Data) != exp {
+				t.Errorf("expected %s (owner) got %s (%s)", exp, msg.Data, msg.Role())
+			}
+
+		case <-time.After(10 * time.Second):
+			t.Fatal("expected a subscription update")
+		}
+	}
+}
+
+func TestSubscriptionResume(t *testing.T) {
+	gql := `subscription test {
+		products(
+			where: { id: { lesser_or_equals: 100 } }
+			first: 3
+			after: $cursor
+			order_by: { price: desc }) {
+			name
+		}
+		products_cursor
+	}`
+
+	conf := &core.Config{DBType: dbType, DisableAllowList: true, PollDuration: 1, SubsCatchUpPages: 2}
+	gj, err := core.NewGraphJin(conf, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		Products json.RawMessage `json:"products"`
+		Cursor   string          `json:"products_cursor"`
+	}
+
+	read := func(m *core.Member) result {
+		var val result
+
+		select {
+		case msg := <-m.Result:
+			if err := json.Unmarshal(msg.Data, &val); err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("expected a subscription update")
+		}
+		return val
+	}
+
+	m1, err := gj.Subscribe(context.Background(), gql, json.RawMessage(`{"cursor": null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	val := read(m1)
+	m1.Unsubscribe()
+
+	if val.Cursor == "" {
+		t.Fatal("product_cursor value missing")
+	}
+
+	// resuming from the cursor delivers the pages after it right away
+	vars := json.RawMessage(fmt.Sprintf(`{"cursor": %q}`, val.Cursor))
+
+	m2, err := gj.Subscribe(context.Background(), gql, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m2.Unsubscribe()
+
+	exp := []string{
+		`[{"name": "Product 97"}, {"name": "Product 96"}, {"name": "Product 95"}]`,
+		`[{"name": "Product 94"}, {"name": "Product 93"}, {"name": "Product 92"}]`,
+	}
+
+	for _, e := range exp {
+		if v := string(read(m2).Products); v != e {
+			t.Errorf("expected '%s' got '%s'", e, v)
+		}
+	}
+}
+
+func TestSubscriptionResumeUnsubscribe(t *testing.T) {
+	gql := `subscription test {
+		products(
+			where: { id: { lesser_or_equals: 100 } }
+			first: 3
+			after: $cursor
+			order_by: { price: desc }) {
+			name
+		}
+		products_cursor
+	}`
+
+	conf := &core.Config{DBType: dbType, DisableAllowList: true, PollDuration: 1, SubsCatchUpPages: 100}
+	gj, err := core.NewGraphJin(conf, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m1, err := gj.Subscribe(context.Background(), gql, json.RawMessage(`{"cursor": null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m1.Unsubscribe()
+
+	var val struct {
+		Cursor string `json:"products_cursor"`
+	}
+
+	select {
+	case msg := <-m1.Result:
+		if err := json.Unmarshal(msg.Data, &val); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected a subscription update")
+	}
+
+	// the catch up blocks once the result channel is full
+	vars := json.RawMessage(fmt.Sprintf(`{"cursor": %q}`, val.Cursor))
+
+	m2, err := gj.Subscribe(context.Background(), gql, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	m2.Unsubscribe()
+
+	select {
+	case <-m2.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the subscription to end while catching up")
+	}
+
+	// the other member is still subscribed
+	if _, err := db.Exec(`UPDATE products SET name = 'Product 100!' WHERE id = 100`); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(`UPDATE products SET name = 'Product 100' WHERE id = 100`) //nolint: errcheck
+
+	select {
+	case <-m1.Result:
+	case <-m1.Done():
+		t.Fatal("expected the subscription to continue")
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected a subscription update")
+	}
+}
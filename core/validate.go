@@ -0,0 +1,153 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	_log "log"
+
+	"github.com/dosco/graphjin/core/internal/qcode"
+	"github.com/dosco/graphjin/core/internal/sdata"
+)
+
+// ValidateConfig checks the config against the database schema and returns all
+// the problems found instead of stopping at the first one. This includes unknown
+// tables and columns in tables, roles and resolvers and invalid role filters.
+func ValidateConfig(conf *Config, db *sql.DB) []error {
+	if conf.DBType == "" {
+		conf.DBType = "postgres"
+	}
+
+	dbinfo, err := sdata.GetDBInfo(db, conf.DBType, conf.Blocklist)
+	if err != nil {
+		return []error{fmt.Errorf("%s: %w", conf.DBType, err)}
+	}
+
+	return validateConfig(conf, dbinfo)
+}
+
+func validateConfig(conf *Config, dbinfo *sdata.DBInfo) []error {
+	var errs []error
+
+	gj := &GraphJin{
+		conf:   conf,
+		dbinfo: dbinfo,
+		log:    _log.New(ioutil.Discard, "", 0),
+	}
+
+	if err := gj.initConfig(); err != nil {
+		return []error{err}
+	}
+
+	if len(dbinfo.Tables) == 0 {
+		return []error{fmt.Errorf("no tables found in database")}
+	}
+
+	for _, t := range conf.Tables {
+		var err error
+
+		switch t.Type {
+		case "json", "jsonb":
+			err = addJsonTable(conf, dbinfo, t)
+
+		case "polymorphic":
+			err = addVirtualTable(conf, dbinfo, t)
+
+		default:
+			err = updateTable(conf, dbinfo, t)
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tables: %s: %w", t.Name, err))
+		}
+	}
+
+	for _, t := range conf.Tables {
+		if t.Type == "polymorphic" {
+			continue
+		}
+		for _, c := range t.Columns {
+			if c.ForeignKey == "" {
+				continue
+			}
+			if err := addForeignKey(conf, dbinfo, c, t); err != nil {
+				errs = append(errs, fmt.Errorf("tables: %s: %w", t.Name, err))
+			}
+		}
+	}
+
+	gj.rmap = make(map[string]resItem)
+
+	if _, ok := conf.rtmap["remote_api"]; !ok {
+		//nolint: errcheck
+		conf.SetResolver("remote_api", func(v ResolverProps) (Resolver, error) {
+			return newRemoteAPI(v)
+		})
+	}
+
+	for _, r := range conf.Resolvers {
+		if err := gj.initRemote(r); err != nil {
+			errs = append(errs, fmt.Errorf("resolvers: %s: %w", r.Name, err))
+		}
+	}
+
+	schema, err := sdata.NewDBSchema(dbinfo, getDBTableAliases(conf))
+	if err != nil {
+		return append(errs, err)
+	}
+
+	qc, err := qcode.NewCompiler(schema, qcode.Config{DefaultBlock: conf.DefaultBlock})
+	if err != nil {
+		return append(errs, err)
+	}
+
+	for _, r := range conf.Roles {
+		for _, t := range r.Tables {
+			if err := validateRoleTable(schema, qc, r, t, conf.DefaultBlock); err != nil {
+				errs = append(errs, fmt.Errorf("roles: %s: table %s: %w", r.Name, t.Name, err))
+			}
+		}
+	}
+
+	return errs
+}
+
+func validateRoleTable(
+	schema *sdata.DBSchema,
+	qc *qcode.Compiler,
+	r Role,
+	t RoleTable,
+	defaultBlock bool) error {
+
+	ti, err := schema.Find(t.Schema, t.Name)
+	if err != nil {
+		return err
+	}
+
+	var cols []string
+
+	if t.Query != nil {
+		cols = append(cols, t.Query.Columns...)
+	}
+	if t.Insert != nil {
+		cols = append(cols, t.Insert.Columns...)
+	}
+	if t.Update != nil {
+		cols = append(cols, t.Update.Columns...)
+	}
+	if t.Upsert != nil {
+		cols = append(cols, t.Upsert.Columns...)
+	}
+	if t.Delete != nil {
+		cols = append(cols, t.Delete.Columns...)
+	}
+
+	for _, c := range cols {
+		if _, err := ti.GetColumn(c); err != nil {
+			return err
+		}
+	}
+
+	// compiles the filters
+	return addRole(qc, r, t, defaultBlock)
+}
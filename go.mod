@@ -61,6 +61,7 @@ require (
 	google.golang.org/genproto v0.0.0-20200923140941-5646d36feee1 // indirect
 	google.golang.org/grpc v1.32.0 // indirect
 	gopkg.in/ini.v1 v1.61.0 // indirect
+	gopkg.in/yaml.v2 v2.3.0
 )
 
 go 1.14
@@ -0,0 +1,140 @@
+// Package envsubst expands environment variables and secret files
+// referenced in config values.
+//
+//	${NAME}            value of the environment variable NAME
+//	${NAME:-default}   default is used when NAME is not set or empty
+//	${file:/path}      contents of the file without the trailing newline
+//	$${                a literal ${
+package envsubst
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+const filePrefix = "file:"
+
+// Expand replaces all the variable references in the string
+func Expand(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var sb strings.Builder
+
+	for {
+		i := strings.Index(s, "${")
+		if i == -1 {
+			sb.WriteString(s)
+			break
+		}
+
+		// escaped with a $
+		if i != 0 && s[i-1] == '$' {
+			sb.WriteString(s[:i-1])
+			sb.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+
+		sb.WriteString(s[:i])
+
+		j := strings.IndexByte(s[i:], '}')
+		if j == -1 {
+			return "", fmt.Errorf("unterminated variable: %s", s[i:])
+		}
+
+		v, err := lookup(s[i+2 : i+j])
+		if err != nil {
+			return "", err
+		}
+
+		sb.WriteString(v)
+		s = s[i+j+1:]
+	}
+
+	return sb.String(), nil
+}
+
+func lookup(ref string) (string, error) {
+	if strings.HasPrefix(ref, filePrefix) {
+		fn := strings.TrimPrefix(ref, filePrefix)
+
+		if fn == "" {
+			return "", fmt.Errorf("file path missing: ${%s}", ref)
+		}
+
+		b, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+
+	name, def := ref, ""
+	hasDef := false
+
+	if n := strings.Index(ref, ":-"); n != -1 {
+		name, def, hasDef = ref[:n], ref[n+2:], true
+	}
+
+	if !isName(name) {
+		return "", fmt.Errorf("invalid variable name: ${%s}", ref)
+	}
+
+	v := os.Getenv(name)
+
+	if v != "" {
+		return v, nil
+	}
+
+	if hasDef {
+		return def, nil
+	}
+
+	if _, ok := os.LookupEnv(name); !ok {
+		return "", fmt.Errorf("environment variable not set: %s", name)
+	}
+
+	return "", nil
+}
+
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i != 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// DecoderOption adds expansion of all string values to the config decoder,
+// it can be passed to viper's Unmarshal function.
+func DecoderOption(dc *mapstructure.DecoderConfig) {
+	hook := func(from, to reflect.Type, data interface{}) (interface{}, error) {
+		if from.Kind() != reflect.String {
+			return data, nil
+		}
+		return Expand(reflect.ValueOf(data).String())
+	}
+
+	if dc.DecodeHook == nil {
+		dc.DecodeHook = hook
+	} else {
+		dc.DecodeHook = mapstructure.ComposeDecodeHookFunc(hook, dc.DecodeHook)
+	}
+}
@@ -0,0 +1,106 @@
+package envsubst
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+func TestExpand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "envsubst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	secret := filepath.Join(dir, "secret")
+
+	if err := ioutil.WriteFile(secret, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("ENVSUBST_HOST", "db.local")
+	os.Setenv("ENVSUBST_EMPTY", "")
+	defer os.Unsetenv("ENVSUBST_HOST")
+	defer os.Unsetenv("ENVSUBST_EMPTY")
+
+	tests := []struct {
+		in  string
+		exp string
+		err bool
+	}{
+		{in: "plain value", exp: "plain value"},
+		{in: "${ENVSUBST_HOST}", exp: "db.local"},
+		{in: "postgres://${ENVSUBST_HOST}:5432/app", exp: "postgres://db.local:5432/app"},
+		{in: "${ENVSUBST_MISSING:-localhost}", exp: "localhost"},
+		{in: "${ENVSUBST_EMPTY:-fallback}", exp: "fallback"},
+		{in: "${ENVSUBST_EMPTY}", exp: ""},
+		{in: "${ENVSUBST_MISSING:-}", exp: ""},
+		{in: "${file:" + secret + "}", exp: "s3cret"},
+		{in: "cost $${ENVSUBST_HOST}", exp: "cost ${ENVSUBST_HOST}"},
+		{in: "${ENVSUBST_MISSING}", err: true},
+		{in: "${ENVSUBST_HOST", err: true},
+		{in: "${1ABC}", err: true},
+		{in: "${file:" + filepath.Join(dir, "missing") + "}", err: true},
+	}
+
+	for _, tt := range tests {
+		v, err := Expand(tt.in)
+
+		switch {
+		case tt.err && err == nil:
+			t.Errorf("%s: expected an error", tt.in)
+		case !tt.err && err != nil:
+			t.Errorf("%s: %s", tt.in, err)
+		case v != tt.exp:
+			t.Errorf("%s: expected '%s' got '%s'", tt.in, tt.exp, v)
+		}
+	}
+}
+
+func TestDecoderOption(t *testing.T) {
+	var conf struct {
+		Port    int
+		Timeout time.Duration
+		Auths   []struct {
+			Name   string
+			Secret string
+		}
+	}
+
+	os.Setenv("ENVSUBST_SECRET", "abc")
+	defer os.Unsetenv("ENVSUBST_SECRET")
+
+	in := map[string]interface{}{
+		"port":    "${ENVSUBST_PORT:-8080}",
+		"timeout": "${ENVSUBST_TIMEOUT:-5s}",
+		"auths": []interface{}{
+			map[string]interface{}{"name": "jwt", "secret": "${ENVSUBST_SECRET}"},
+		},
+	}
+
+	dc := &mapstructure.DecoderConfig{
+		Result:           &conf,
+		WeaklyTypedInput: true,
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+	}
+	DecoderOption(dc)
+
+	d, err := mapstructure.NewDecoder(dc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Decode(in); err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.Port != 8080 || conf.Timeout != 5*time.Second ||
+		len(conf.Auths) != 1 || conf.Auths[0].Secret != "abc" {
+		t.Errorf("unexpected config: %+v", conf)
+	}
+}
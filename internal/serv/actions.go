@@ -1,8 +1,15 @@
 package serv
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+
+	"github.com/dosco/graphjin/core"
+	"github.com/dosco/graphjin/internal/serv/internal/auth"
 )
 
 type actionFn func(w http.ResponseWriter, r *http.Request) error
@@ -11,9 +18,14 @@ func newAction(servConf *ServConfig, a *Action) (http.Handler, error) {
 	var fn actionFn
 	var err error
 
-	if a.SQL != "" {
+	switch {
+	case a.SQL != "":
 		fn, err = newSQLAction(servConf, a)
-	} else {
+	case a.Query != "":
+		fn, err = newQueryAction(servConf, a)
+	case a.Webhook.URL != "":
+		fn, err = newWebhookAction(servConf, a)
+	default:
 		return nil, fmt.Errorf("invalid config for action '%s'", a.Name)
 	}
 
@@ -38,3 +50,138 @@ func newSQLAction(servConf *ServConfig, a *Action) (actionFn, error) {
 
 	return fn, nil
 }
+
+// newQueryAction runs a named query from the allow list. Variables like
+// $user_id come from the auth context and cannot be set by the request.
+func newQueryAction(servConf *ServConfig, a *Action) (actionFn, error) {
+	nq, ok := gj.NamedQuery(a.Query)
+	if !ok {
+		return nil, fmt.Errorf("action %s: query not found in allow list: %s", a.Name, a.Query)
+	}
+	if nq.Operation == core.OpSubscription {
+		return nil, fmt.Errorf("action %s: subscriptions cannot be run as actions: %s", a.Name, a.Query)
+	}
+
+	fn := func(w http.ResponseWriter, r *http.Request) error {
+		ct := r.Context()
+		w.Header().Set("Content-Type", "application/json")
+
+		if servConf.conf.AuthFailBlock && !auth.IsAuth(ct) {
+			return errUnauthorized
+		}
+
+		// the variables are typed the same way as for the rest endpoints
+		nq, _ := gj.NamedQuery(a.Query)
+
+		vars, err := restVars(r, nq)
+		if err != nil {
+			return err
+		}
+
+		rc := newReqConfig(servConf, r)
+
+		res, err := gj.GraphQLByName(ct, a.Query, vars, &rc)
+
+		if servConf.logLevel >= LogLevelInfo {
+			reqLog(servConf, res, err)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return json.NewEncoder(w).Encode(res)
+	}
+
+	return fn, nil
+}
+
+// newWebhookAction proxies the request to the webhook, the user identity
+// from the auth context is passed on in the X-User-* headers.
+func newWebhookAction(servConf *ServConfig, a *Action) (actionFn, error) {
+	client := &http.Client{Timeout: a.Webhook.Timeout}
+
+	if client.Timeout == 0 {
+		client.Timeout = defaultWebhookTimeout
+	}
+
+	fn := func(w http.ResponseWriter, r *http.Request) error {
+		ct := r.Context()
+
+		if servConf.conf.AuthFailBlock && !auth.IsAuth(ct) {
+			return errUnauthorized
+		}
+
+		b, err := ioutil.ReadAll(io.LimitReader(r.Body, maxReadBytes))
+		if err != nil {
+			return err
+		}
+		defer r.Body.Close()
+
+		method := a.Webhook.Method
+		if method == "" {
+			method = r.Method
+		}
+
+		u := a.Webhook.URL
+		if r.URL.RawQuery != "" {
+			u += "?" + r.URL.RawQuery
+		}
+
+		req, err := http.NewRequest(method, u, bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		req = req.WithContext(ct)
+
+		if v := r.Header.Get("Content-Type"); v != "" {
+			req.Header.Set("Content-Type", v)
+		}
+
+		for _, h := range a.Webhook.PassHeaders {
+			if v := r.Header.Get(h); v != "" {
+				req.Header.Set(h, v)
+			}
+		}
+
+		for k, v := range a.Webhook.Headers {
+			req.Header.Set(k, v)
+		}
+
+		setUserHeaders(req.Header, r)
+
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		if v := res.Header.Get("Content-Type"); v != "" {
+			w.Header().Set("Content-Type", v)
+		}
+		w.WriteHeader(res.StatusCode)
+
+		_, err = io.Copy(w, res.Body)
+		return err
+	}
+
+	return fn, nil
+}
+
+func setUserHeaders(h http.Header, r *http.Request) {
+	ct := r.Context()
+
+	hm := map[string]interface{}{
+		"X-User-ID":          ct.Value(core.UserIDKey),
+		"X-User-ID-Provider": ct.Value(core.UserIDProviderKey),
+		"X-User-Role":        ct.Value(core.UserRoleKey),
+	}
+
+	for k, v := range hm {
+		if v != nil {
+			h.Set(k, fmt.Sprintf("%v", v))
+		} else {
+			h.Del(k)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package serv
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dosco/graphjin/core"
+)
+
+func TestActionVars(t *testing.T) {
+	nq := core.NamedQuery{
+		Name:      "tagProduct",
+		Operation: core.OpMutation,
+		Vars: []core.QueryVar{
+			{Name: "id", Type: "Int", Required: true},
+			{Name: "tag", Type: "String", List: true},
+			{Name: "limit", Type: "Int"},
+		},
+	}
+
+	r := httptest.NewRequest("PUT", "/api/v1/actions/test?id=5&tag=a&tag=b&limit=10",
+		strings.NewReader(`{"limit": 20, "data": {"name": "x"}}`))
+
+	vars, err := restVars(r, nq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `{"data":{"name":"x"},"id":5,"limit":20,"tag":["a","b"]}`
+
+	if string(vars) != exp {
+		t.Errorf("expected %s got %s", exp, vars)
+	}
+
+	r = httptest.NewRequest("PUT", "/api/v1/actions/test?id=five", nil)
+
+	if _, err := restVars(r, nq); err == nil {
+		t.Error("expected error for an invalid id")
+	}
+
+	r = httptest.NewRequest("PUT", "/api/v1/actions/test?id=5", strings.NewReader(`[1, 2]`))
+
+	if _, err := restVars(r, nq); err == nil {
+		t.Error("expected error for non-object body")
+	}
+}
+
+func TestWebhookAction(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+
+		if r.Method != "PUT" || r.URL.RawQuery != "a=1" || string(b) != `{"x":1}` {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if r.Header.Get("X-User-ID") != "7" || r.Header.Get("X-Api-Key") != "secret" ||
+			r.Header.Get("X-Trace") != "abc" || r.Header.Get("X-User-Role") != "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"ok":true}`)) //nolint: errcheck
+	}))
+	defer ts.Close()
+
+	a := &Action{Name: "proxy"}
+	a.Webhook.URL = ts.URL
+	a.Webhook.Method = "PUT"
+	a.Webhook.Headers = map[string]string{"X-Api-Key": "secret"}
+	a.Webhook.PassHeaders = []string{"X-Trace"}
+
+	sc := &ServConfig{conf: &Config{}}
+
+	h, err := newAction(sc, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("POST", "/api/v1/actions/proxy?a=1", strings.NewReader(`{"x":1}`))
+	r.Header.Set("X-Trace", "abc")
+	r.Header.Set("X-User-Role", "admin")
+	r = r.WithContext(context.WithValue(r.Context(), core.UserIDKey, 7))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusCreated || w.Body.String() != `{"ok":true}` {
+		t.Errorf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+}
@@ -51,6 +51,27 @@ type Serv struct {
 	APIPath        string   `mapstructure:"api_path"`
 	CacheControl   string   `mapstructure:"cache_control"`
 
+	// ExplainEndpoint enables the /api/v1/explain debug endpoint
+	// that returns query plans, it is disabled in production
+	ExplainEndpoint bool `mapstructure:"explain_endpoint"`
+
+	// OpenAPIEndpoint serves the /api/v1/openapi.json document in
+	// production, it's always served in development
+	OpenAPIEndpoint bool `mapstructure:"openapi_endpoint"`
+
+	// TLS serves the api over https, with a client_ca client
+	// certificates are verified and can be used by the mtls auth
+	TLS struct {
+		Cert     string
+		Key      string
+		ClientCA string `mapstructure:"client_ca"`
+
+		// ClientAuth is verify_if_given or require, require rejects
+		// connections without a valid client certificate.
+		// Defaults to verify_if_given
+		ClientAuth string `mapstructure:"client_auth"`
+	} `mapstructure:"tls"`
+
 	// Telemetry struct contains OpenCensus metrics and tracing related config
 	Telemetry struct {
 		Debug    bool
@@ -71,6 +92,18 @@ type Serv struct {
 		}
 	}
 
+	// Websockets struct contains config values for the
+	// graphql-transport-ws websocket protocol
+	Websockets struct {
+		// InitTimeout is how long to wait for the connection_init
+		// message before closing the connection. Defaults to 10s
+		InitTimeout time.Duration `mapstructure:"init_timeout"`
+
+		// PingInterval is how often keepalive pings are sent to the
+		// client. Defaults to 12s
+		PingInterval time.Duration `mapstructure:"ping_interval"`
+	}
+
 	Auth  auth.Auth
 	Auths []auth.Auth
 
@@ -95,13 +128,83 @@ type Serv struct {
 
 	Actions []Action
 
+	// Jobs contains the scheduled jobs run by the service
+	Jobs []Job
+
+	// EventTriggers contains the table event triggers that record changes
+	// made by mutations and deliver them to webhooks
+	EventTriggers []EventTrigger `mapstructure:"event_triggers"`
+
+	// Events struct contains config values for the delivery of
+	// events recorded by the event triggers
+	Events struct {
+		// OutboxTable is the table the events are written to.
+		// Defaults to graphjin_events
+		OutboxTable string `mapstructure:"outbox_table"`
+
+		// PollEvery is how often the outbox table is checked for
+		// new events. Defaults to 2s
+		PollEvery time.Duration `mapstructure:"poll_every"`
+
+		// BatchSize is the number of events delivered on
+		// each check. Defaults to 50
+		BatchSize int `mapstructure:"batch_size"`
+
+		// MaxRetries is the number of failed deliveries after which
+		// an event is marked dead. Defaults to 8
+		MaxRetries int `mapstructure:"max_retries"`
+
+		// RetryBackoff is the wait after the first failed delivery, it
+		// doubles with each retry. Defaults to 5s
+		RetryBackoff time.Duration `mapstructure:"retry_backoff"`
+	}
+
 	RateLimiter struct {
 		Rate     float64
 		Bucket   int
 		IPHeader string `mapstructure:"ip_header"`
+
+		// Limits are rate limits counted per user, api key or role
+		Limits []RateLimit
+
+		// Store keeps the request counts for the limits: memory or
+		// redis to share them across instances. Defaults to memory
+		Store string
+
+		// Redis connection used by the redis store
+		Redis struct {
+			URL      string
+			Password string
+			Prefix   string
+		}
 	} `mapstructure:"rate_limiter"`
 }
 
+// RateLimit struct contains the config for a rate limit
+type RateLimit struct {
+	Name string
+
+	// By is what the requests are counted by: user, api_key or role.
+	// Requests without one are not counted. Defaults to user
+	By string
+
+	// Operations the limit applies to: query, mutation or subscription.
+	// Defaults to all operations
+	Operations []string
+
+	// Roles the limit applies to. Defaults to all roles
+	Roles []string
+
+	// Limit is the total cost of the requests allowed in the window
+	Limit int
+
+	// Window is the duration the requests are counted over. Defaults to 1m
+	Window time.Duration
+
+	// Cost of each request counted by the limit. Defaults to 1
+	Cost int
+}
+
 // Auth struct contains authentication related config values used by the GraphJin service
 type Auth struct {
 	Name          string
@@ -134,9 +237,64 @@ type Auth struct {
 	}
 }
 
-// Action struct contains config values for a GraphJin service action
+// Action struct contains config values for a GraphJin service action. An
+// action either runs an SQL statement, a named query from the allow list or
+// proxies the request to a webhook.
 type Action struct {
-	Name     string
-	SQL      string
+	Name string
+	SQL  string
+
+	// Query is the name of a query or mutation from the allow list, the
+	// variables are taken from the url query params and the json body
+	Query string
+
+	Webhook struct {
+		URL         string
+		Method      string
+		Headers     map[string]string
+		PassHeaders []string `mapstructure:"pass_headers"`
+		Timeout     time.Duration
+	}
+
 	AuthName string `mapstructure:"auth_name"`
 }
+
+// EventTrigger struct contains config values for a table event trigger
+type EventTrigger struct {
+	Name   string
+	Table  string
+	Schema string
+
+	// Operations is a list of insert, update and delete
+	Operations []string
+
+	// Columns limits update events to changes in these columns
+	Columns []string
+
+	Webhook struct {
+		URL     string
+		Secret  string
+		Headers map[string]string
+		Timeout time.Duration
+	}
+}
+
+// Job struct contains config values for a scheduled job. A job runs
+// either a named query from the allow list or an SQL statement.
+type Job struct {
+	Name string
+
+	// Schedule is a cron expression (eg. "*/15 * * * *" or "@hourly")
+	Schedule string
+
+	// Query is the name of a query or mutation from the allow list
+	Query string
+	Vars  map[string]interface{}
+
+	SQL string
+
+	// Role and UserID are used when running the query,
+	// they cannot be set for sql jobs
+	Role   string
+	UserID string `mapstructure:"user_id"`
+}
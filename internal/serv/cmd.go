@@ -32,6 +32,7 @@ type ServConfig struct {
 	conf     *Config            // parsed config
 	confPath string             // path to config
 	db       *sql.DB            // database connection pool
+	limits   *rateLimits        // per user, api key and role rate limits
 }
 
 func Cmd() {
@@ -122,6 +123,45 @@ e.g. db:migrate -+1
 		Run:   cmdDBReset(servConf),
 	})
 
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "db:schema [FILE]",
+		Short: "Save a snapshot of the database schema",
+		Long:  "Save the database schema to a file (default: stdout) that can be used to verify the allow list without a database",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   cmdDBSchema(servConf),
+	})
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "events:list [pending|delivered|dead]",
+		Short: "List recent events",
+		Long:  "List the most recent events from the event triggers outbox with the selected status (default: dead)",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   cmdEventsList(servConf),
+	})
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "events:retry [ID...|all]",
+		Short: "Retry dead events",
+		Long:  "Queue dead events for delivery again, the attempts count is reset",
+		Run:   cmdEventsRetry(servConf),
+	})
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "jobs:history [NAME]",
+		Short: "List recent job runs",
+		Long:  "List the most recent runs of the scheduled jobs or a single job",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   cmdJobsHistory(servConf),
+	})
+
+	rootCmd.AddCommand(allowListCmds(servConf)...)
+
+	rootCmd.AddCommand(apiKeyCmds(servConf)...)
+
+	rootCmd.AddCommand(queryCmd(servConf))
+
+	rootCmd.AddCommand(explainCmd(servConf))
+
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "new APP-NAME",
 		Short: "Create a new application",
@@ -129,12 +169,26 @@ e.g. db:migrate -+1
 		Run:   cmdNew(servConf),
 	})
 
-	// rootCmd.AddCommand(&cobra.Command{
-	// 	Use:   fmt.Sprintf("conf:dump [%s]", strings.Join(viper.SupportedExts, "|")),
-	// 	Short: "Dump config to file",
-	// 	Long:  "Dump current config to a file in the selected format",
-	// 	Run:   cmdConfDump,
-	// })
+	var showRoles bool
+
+	confValidateCmd := &cobra.Command{
+		Use:   "conf:validate",
+		Short: "Validate the config",
+		Long:  "Check the config for unknown keys, invalid values and tables, columns and filters that do not match the database",
+		Run:   cmdConfValidate(servConf, &showRoles),
+	}
+	confValidateCmd.Flags().BoolVar(&showRoles, "roles", false,
+		"print the table permissions of each role including the inherited ones")
+
+	rootCmd.AddCommand(confValidateCmd)
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "conf:dump [yaml|json] [FILE]",
+		Short: "Dump the config",
+		Long:  "Write the loaded config including inherited values and defaults with the secrets masked in the selected format (default: yaml) to a file or stdout",
+		Args:  cobra.MaximumNArgs(2),
+		Run:   cmdConfDump(servConf),
+	})
 
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "version",
@@ -0,0 +1,259 @@
+package serv
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dosco/graphjin/core"
+	"github.com/spf13/cobra"
+)
+
+type queryCheck struct {
+	nq     core.NamedQuery
+	roles  []string
+	errors []core.RoleCheck
+}
+
+func allowListCmds(servConf *ServConfig) []*cobra.Command {
+	var schemaFile string
+	var dryRun bool
+
+	verifyCmd := &cobra.Command{
+		Use:   "allowlist:verify",
+		Short: "Verify the queries in the allow list",
+		Long: `Compile every query in the allow list for every role against the database schema
+and report every query and role that fails. Use --schema to verify against a
+schema snapshot saved with db:schema instead of the database.`,
+		Run: cmdAllowListVerify(servConf, &schemaFile),
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "allowlist:list",
+		Short: "List the queries in the allow list",
+		Long:  "List the queries in the allow list with the roles that can run them and their hash",
+		Run:   cmdAllowListList(servConf, &schemaFile),
+	}
+
+	pruneCmd := &cobra.Command{
+		Use:   "allowlist:prune",
+		Short: "Remove the queries no role can run",
+		Long:  "Remove the queries from the allow list that fail to compile for every role",
+		Run:   cmdAllowListPrune(servConf, &schemaFile, &dryRun),
+	}
+
+	exportCmd := &cobra.Command{
+		Use:   "allowlist:export [FILE]",
+		Short: "Export the allow list to a single file",
+		Long: `Write all the queries and fragments in the allow list to a single file (default: stdout).
+When this file is saved as allow.list in the config folder the queries and fragments
+folders are created from it.`,
+		Args: cobra.MaximumNArgs(1),
+		Run:  cmdAllowListExport(servConf, &schemaFile),
+	}
+
+	for _, c := range []*cobra.Command{verifyCmd, listCmd, pruneCmd, exportCmd} {
+		c.Flags().StringVar(&schemaFile, "schema", "", "use a schema snapshot instead of the database")
+	}
+
+	pruneCmd.Flags().BoolVar(&dryRun, "dry-run", false, "only list the queries that would be removed")
+
+	return []*cobra.Command{verifyCmd, listCmd, pruneCmd, exportCmd}
+}
+
+func cmdAllowListVerify(servConf *ServConfig, schemaFile *string) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		var failed int
+
+		initAllowListGJ(servConf, *schemaFile)
+		checks := checkAllowList(servConf)
+
+		for _, qc := range checks {
+			if len(qc.errors) == 0 {
+				continue
+			}
+			failed++
+
+			for _, rc := range qc.errors {
+				fmt.Printf("%s:%d: %s: role '%s': %s\n",
+					qc.nq.File, qc.nq.Line, qc.nq.Name, rc.Role, rc.Err)
+			}
+		}
+
+		if failed != 0 {
+			servConf.log.Fatalf("%d of %d queries failed verification for one or more roles",
+				failed, len(checks))
+		}
+
+		servConf.log.Infof("%d queries verified", len(checks))
+	}
+}
+
+func cmdAllowListList(servConf *ServConfig, schemaFile *string) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		initAllowListGJ(servConf, *schemaFile)
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tTYPE\tROLES\tHASH")
+
+		for _, qc := range checkAllowList(servConf) {
+			roles := strings.Join(qc.roles, ",")
+			if roles == "" {
+				roles = "-"
+			}
+
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n",
+				qc.nq.Name, qc.nq.Operation, roles, queryHash(qc.nq.Query))
+		}
+		tw.Flush()
+	}
+}
+
+func cmdAllowListPrune(servConf *ServConfig, schemaFile *string, dryRun *bool) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		var n int
+
+		initAllowListGJ(servConf, *schemaFile)
+
+		for _, qc := range checkAllowList(servConf) {
+			if len(qc.roles) != 0 {
+				continue
+			}
+
+			if !*dryRun {
+				if err := gj.RemoveNamedQuery(qc.nq.Name); err != nil {
+					servConf.log.Fatalf("Failed to remove query: %s", err)
+				}
+			}
+
+			fmt.Printf("%s (%s)\n", qc.nq.Name, qc.nq.File)
+			n++
+		}
+
+		if *dryRun {
+			servConf.log.Infof("%d queries would be removed", n)
+		} else {
+			servConf.log.Infof("%d queries removed", n)
+		}
+	}
+}
+
+func cmdAllowListExport(servConf *ServConfig, schemaFile *string) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		var w io.Writer = os.Stdout
+
+		initAllowListGJ(servConf, *schemaFile)
+
+		if len(args) != 0 {
+			f, err := os.Create(args[0])
+			if err != nil {
+				servConf.log.Fatalf("Failed to create file: %s", err)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		if err := gj.ExportAllowList(w); err != nil {
+			servConf.log.Fatalf("Failed to export allow list: %s", err)
+		}
+	}
+}
+
+func cmdDBSchema(servConf *ServConfig) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		initConfOnce(servConf)
+
+		db, err := initDB(servConf, true, false)
+		if err != nil {
+			servConf.log.Fatalf("Failed to connect to database: %s", err)
+		}
+		defer db.Close()
+
+		b, err := core.DumpSchema(&servConf.conf.Core, db)
+		if err != nil {
+			servConf.log.Fatalf("Failed to read database schema: %s", err)
+		}
+
+		if len(args) == 0 {
+			fmt.Println(string(b))
+			return
+		}
+
+		if err := ioutil.WriteFile(args[0], b, 0600); err != nil {
+			servConf.log.Fatalf("Failed to save schema: %s", err)
+		}
+		servConf.log.Infof("Schema saved to %s", args[0])
+	}
+}
+
+// initAllowListGJ initializes GraphJin with the allow list loaded using
+// either the database or a schema snapshot
+func initAllowListGJ(servConf *ServConfig, schemaFile string) {
+	var err error
+
+	initConfOnce(servConf)
+
+	if servConf.conf.DisableAllowList {
+		servConf.log.Fatalf("Allow list is disabled")
+	}
+
+	// needed for queries to use saved fragments
+	servConf.conf.EnforceAllowList = true
+
+	if schemaFile != "" {
+		b, err := ioutil.ReadFile(schemaFile)
+		if err != nil {
+			servConf.log.Fatalf("Failed to read schema: %s", err)
+		}
+
+		gj, err = core.NewGraphJinWithSchema(&servConf.conf.Core, b)
+		if err != nil {
+			servConf.log.Fatalf("GraphJin failed to initialize: %s", err)
+		}
+		return
+	}
+
+	servConf.db, err = initDB(servConf, true, false)
+	if err != nil {
+		servConf.log.Fatalf("Failed to connect to database: %s", err)
+	}
+
+	gj, err = core.NewGraphJin(&servConf.conf.Core, servConf.db)
+	if err != nil {
+		servConf.log.Fatalf("GraphJin failed to initialize: %s", err)
+	}
+}
+
+func checkAllowList(servConf *ServConfig) []queryCheck {
+	var checks []queryCheck
+
+	for _, nq := range gj.NamedQueries() {
+		qc := queryCheck{nq: nq}
+
+		rcs, err := gj.CheckNamedQuery(nq.Name)
+		if err != nil {
+			servConf.log.Fatalf("Failed to verify query: %s", err)
+		}
+
+		for _, rc := range rcs {
+			if rc.Err == nil {
+				qc.roles = append(qc.roles, rc.Role)
+			} else {
+				qc.errors = append(qc.errors, rc)
+			}
+		}
+		checks = append(checks, qc)
+	}
+
+	return checks
+}
+
+func queryHash(query string) string {
+	h := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,102 @@
+package serv
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dosco/graphjin/internal/serv/internal/auth"
+	"github.com/spf13/cobra"
+)
+
+func apiKeyCmds(servConf *ServConfig) []*cobra.Command {
+	var authName, role string
+	var expires time.Duration
+
+	createCmd := &cobra.Command{
+		Use:   "apikey:create USER-ID",
+		Short: "Create an API key",
+		Long: `Create an API key for the user and print it. Only a hash of the key is saved
+in the api keys table so the key cannot be shown again.`,
+		Args: cobra.ExactArgs(1),
+		Run:  cmdAPIKeyCreate(servConf, &authName, &role, &expires),
+	}
+
+	revokeCmd := &cobra.Command{
+		Use:   "apikey:revoke KEY",
+		Short: "Revoke an API key",
+		Long:  "Revoke an API key, the key can also be given as its hash",
+		Args:  cobra.ExactArgs(1),
+		Run:   cmdAPIKeyRevoke(servConf, &authName),
+	}
+
+	for _, c := range []*cobra.Command{createCmd, revokeCmd} {
+		c.Flags().StringVar(&authName, "auth", "", "name of the api_key auth in auths (default: auth)")
+	}
+
+	createCmd.Flags().StringVar(&role, "role", "", "role for the key")
+	createCmd.Flags().DurationVar(&expires, "expires", 0, "time until the key expires eg. 720h (default: never)")
+
+	return []*cobra.Command{createCmd, revokeCmd}
+}
+
+func cmdAPIKeyCreate(
+	servConf *ServConfig,
+	authName, role *string,
+	expires *time.Duration) func(*cobra.Command, []string) {
+
+	return func(cmd *cobra.Command, args []string) {
+		var exp time.Time
+
+		ac := apiKeyAuth(servConf, *authName)
+
+		db, err := initDB(servConf, true, false)
+		if err != nil {
+			servConf.log.Fatalf("Failed to connect to database: %s", err)
+		}
+		defer db.Close()
+
+		if *expires != 0 {
+			exp = time.Now().Add(*expires)
+		}
+
+		key, err := auth.CreateAPIKey(db, ac, args[0], *role, exp)
+		if err != nil {
+			servConf.log.Fatalf("Failed to create api key: %s", err)
+		}
+
+		fmt.Println(key)
+	}
+}
+
+func cmdAPIKeyRevoke(servConf *ServConfig, authName *string) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		ac := apiKeyAuth(servConf, *authName)
+
+		db, err := initDB(servConf, true, false)
+		if err != nil {
+			servConf.log.Fatalf("Failed to connect to database: %s", err)
+		}
+		defer db.Close()
+
+		if err := auth.RevokeAPIKey(db, ac, args[0]); err != nil {
+			servConf.log.Fatalf("Failed to revoke api key: %s", err)
+		}
+
+		servConf.log.Infof("API key revoked")
+	}
+}
+
+// apiKeyAuth returns the named auth or the main auth config
+func apiKeyAuth(servConf *ServConfig, name string) *auth.Auth {
+	initConfOnce(servConf)
+
+	if name == "" {
+		return &servConf.conf.Auth
+	}
+
+	ac := findAuth(servConf, name)
+	if ac == nil {
+		servConf.log.Fatalf("Auth not found: %s", name)
+	}
+	return ac
+}
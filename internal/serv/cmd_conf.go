@@ -1,21 +1,363 @@
 package serv
 
-// func cmdConfDump(cmd *cobra.Command, args []string) {
-// 	if len(args) != 1 {
-// 		cmd.Help() //nolint: errcheck
-// 		os.Exit(1)
-// 	}
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
 
-// 	fname := fmt.Sprintf("%s.%s", config.GetConfigName(), args[0])
+	"github.com/dosco/graphjin/core"
+	"github.com/dosco/graphjin/internal/envsubst"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
 
-// 	conf, err := initConf()
-// 	if err != nil {
-// 		log.Fatalf("ERR failed to read config: %s", err)
-// 	}
+// config keys that are used but are not decoded into the config struct
+var confExtraKeys = map[string]struct{}{
+	"inherits": {},
+	"env":      {},
+}
 
-// 	if err := conf.WriteConfigAs(fname); err != nil {
-// 		log.Fatalf("ERR failed to write config: %s", err)
-// 	}
+// config keys with values that are masked when the config is dumped
+var confSecretKeys = map[string]struct{}{
+	"password":        {},
+	"secret":          {},
+	"secret_key":      {},
+	"secret_key_base": {},
+	"key":             {},
+	"value":           {},
+}
 
-// 	log.Printf("INF config dumped to ./%s", fname)
-// }
+const confMask = "********"
+
+func cmdConfValidate(servConf *ServConfig, showRoles *bool) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		var problems []string
+
+		vi, err := readConfViper(servConf)
+		if err != nil {
+			servConf.log.Fatalf("Failed to read config: %s", err)
+		}
+
+		problems = append(problems, checkConfKeys(vi)...)
+
+		// the remaining checks need a config that decodes
+		if len(problems) == 0 {
+			if servConf.conf, err = initConf(servConf); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+
+		if len(problems) == 0 {
+			db, err := initDB(servConf, true, false)
+			if err != nil {
+				servConf.log.Fatalf("Failed to connect to database: %s", err)
+			}
+			defer db.Close()
+
+			for _, err := range core.ValidateConfig(&servConf.conf.Core, db) {
+				problems = append(problems, err.Error())
+			}
+
+			// roles now include the inherited tables
+			if *showRoles {
+				b, err := yaml.Marshal(rolesSummary(servConf.conf.Roles))
+				if err != nil {
+					servConf.log.Fatalf("Failed to print roles: %s", err)
+				}
+				fmt.Println(string(b))
+			}
+		}
+
+		for _, v := range problems {
+			fmt.Println(v)
+		}
+
+		if len(problems) != 0 {
+			servConf.log.Fatalf("Config has %d problem(s)", len(problems))
+		}
+
+		servConf.log.Infof("Config is valid")
+	}
+}
+
+func cmdConfDump(servConf *ServConfig) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		var b []byte
+		var err error
+
+		if servConf.conf, err = initConf(servConf); err != nil {
+			servConf.log.Fatalf("Failed to read config: %s", err)
+		}
+		conf := dumpConf(servConf.conf)
+
+		format := "yaml"
+		if len(args) != 0 {
+			format = strings.ToLower(args[0])
+		}
+
+		switch format {
+		case "yaml", "yml":
+			b, err = yaml.Marshal(conf)
+		case "json":
+			b, err = json.MarshalIndent(conf, "", "  ")
+		default:
+			err = fmt.Errorf("unsupported format: %s", format)
+		}
+
+		if err != nil {
+			servConf.log.Fatalf("Failed to dump config: %s", err)
+		}
+
+		if len(args) < 2 {
+			fmt.Println(string(b))
+			return
+		}
+
+		if err := ioutil.WriteFile(args[1], b, 0600); err != nil {
+			servConf.log.Fatalf("Failed to write config: %s", err)
+		}
+		servConf.log.Infof("Config dumped to %s", args[1])
+	}
+}
+
+// dumpConf returns the non zero values of the decoded config with the names
+// used in the config, secrets like passwords and the values of webhook
+// headers are masked
+func dumpConf(c *Config) map[string]interface{} {
+	m := make(map[string]interface{})
+	dumpConfFields(reflect.ValueOf(*c), m)
+	return m
+}
+
+func dumpConfFields(v reflect.Value, m map[string]interface{}) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		// unexported fields
+		if f.PkgPath != "" {
+			continue
+		}
+
+		tag := f.Tag.Get("mapstructure")
+
+		if strings.HasSuffix(tag, ",squash") {
+			dumpConfFields(v.Field(i), m)
+			continue
+		}
+
+		name := tag
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+
+		if fv := v.Field(i); !fv.IsZero() {
+			m[name] = dumpConfValue(fv, name)
+		}
+	}
+}
+
+func dumpConfValue(v reflect.Value, name string) interface{} {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return dumpConfValue(v.Elem(), name)
+
+	case reflect.Struct:
+		m := make(map[string]interface{})
+		dumpConfFields(v, m)
+		return m
+
+	case reflect.Slice, reflect.Array:
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = dumpConfValue(v.Index(i), "")
+		}
+		return list
+
+	case reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+
+		for iter.Next() {
+			k := fmt.Sprintf("%v", iter.Key().Interface())
+
+			// headers often hold tokens
+			if name == "headers" {
+				m[k] = confMask
+			} else {
+				m[k] = dumpConfValue(iter.Value(), k)
+			}
+		}
+		return m
+
+	case reflect.String:
+		s := v.String()
+
+		if _, ok := confSecretKeys[name]; ok && s != "" {
+			return confMask
+		}
+
+		// passwords in urls like redis://:secret@localhost
+		if u, err := url.Parse(s); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				user := url.User(u.User.Username()).String() + ":" + confMask
+				return strings.Replace(s, u.User.String(), user, 1)
+			}
+		}
+		return s
+	}
+
+	return v.Interface()
+}
+
+// readConfViper returns the merged config for the
+// current environment including the inherited config
+func readConfViper(servConf *ServConfig) (*viper.Viper, error) {
+	cp, err := filepath.Abs(servConf.confPath)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := ReadInConfig(path.Join(cp, GetConfigName()))
+	if err != nil {
+		return nil, err
+	}
+
+	return c.vi, nil
+}
+
+// checkConfKeys decodes the config again reporting unknown keys
+// and values that cannot be decoded into their type
+func checkConfKeys(vi *viper.Viper) []string {
+	var problems []string
+	var merr *mapstructure.Error
+	var c Config
+
+	err := vi.Unmarshal(&c, envsubst.DecoderOption)
+
+	if errors.As(err, &merr) {
+		problems = append(problems, merr.Errors...)
+	} else if err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	// the decoder stops tracking unknown keys on the first type error
+	// so a second pass replaces all values with zero values
+	var md mapstructure.Metadata
+	var c1 Config
+
+	d, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Metadata:         &md,
+		Result:           &c1,
+		WeaklyTypedInput: true,
+		DecodeHook: func(from, to reflect.Type, data interface{}) (interface{}, error) {
+			switch to.Kind() {
+			case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct,
+				reflect.Ptr, reflect.Interface:
+				return data, nil
+			}
+			return reflect.Zero(to).Interface(), nil
+		},
+	})
+
+	if err == nil {
+		err = d.Decode(vi.AllSettings())
+	}
+
+	if err != nil && len(problems) == 0 {
+		problems = append(problems, err.Error())
+	}
+
+	for _, k := range md.Unused {
+		k = strings.ToLower(k)
+
+		if _, ok := confExtraKeys[k]; !ok {
+			problems = append(problems, fmt.Sprintf("unknown config key: %s", k))
+		}
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+// rolesSummary returns the roles with the names used in the config
+func rolesSummary(roles []core.Role) yaml.MapSlice {
+	var rs yaml.MapSlice
+
+	for _, r := range roles {
+		var tables []yaml.MapSlice
+
+		for _, t := range r.Tables {
+			ts := yaml.MapSlice{{Key: "name", Value: t.Name}}
+
+			if t.Schema != "" {
+				ts = append(ts, yaml.MapItem{Key: "schema", Value: t.Schema})
+			}
+			if t.ReadOnly {
+				ts = append(ts, yaml.MapItem{Key: "read_only", Value: true})
+			}
+			if t.Query != nil {
+				ts = append(ts, yaml.MapItem{Key: "query", Value: confMap(t.Query)})
+			}
+			if t.Insert != nil {
+				ts = append(ts, yaml.MapItem{Key: "insert", Value: confMap(t.Insert)})
+			}
+			if t.Update != nil {
+				ts = append(ts, yaml.MapItem{Key: "update", Value: confMap(t.Update)})
+			}
+			if t.Upsert != nil {
+				ts = append(ts, yaml.MapItem{Key: "upsert", Value: confMap(t.Upsert)})
+			}
+			if t.Delete != nil {
+				ts = append(ts, yaml.MapItem{Key: "delete", Value: confMap(t.Delete)})
+			}
+			tables = append(tables, ts)
+		}
+
+		rs = append(rs, yaml.MapItem{Key: r.Name, Value: tables})
+	}
+
+	return rs
+}
+
+// confMap returns the non zero fields of the struct
+// with the names used in the config
+func confMap(v interface{}) yaml.MapSlice {
+	m := yaml.MapSlice{}
+
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		f := rv.Field(i)
+		if f.IsZero() {
+			continue
+		}
+
+		name := rt.Field(i).Tag.Get("mapstructure")
+		if name == "" {
+			name = strings.ToLower(rt.Field(i).Name)
+		}
+		m = append(m, yaml.MapItem{Key: name, Value: f.Interface()})
+	}
+
+	return m
+}
@@ -0,0 +1,136 @@
+package serv
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestCheckConfKeys(t *testing.T) {
+	conf := `
+app_name: "Test"
+default_limt: 20
+port: 8080
+database:
+  type: postgres
+  max_retries: abc
+roles:
+  - name: user
+    tables:
+      - name: users
+        query:
+          filters: ["{ id: { eq: $user_id } }"]
+          colums: [id, email]
+`
+	vi := newViper("./", "dev")
+	vi.SetConfigType("yaml")
+
+	if err := vi.ReadConfig(strings.NewReader(conf)); err != nil {
+		t.Fatal(err)
+	}
+
+	problems := checkConfKeys(vi)
+
+	exp := []string{
+		"unknown config key: default_limt",
+		"unknown config key: roles[0].tables[0].query.colums",
+		"'database.max_retries'",
+	}
+
+	if len(problems) != len(exp) {
+		t.Fatalf("expected %d problems got %d: %v", len(exp), len(problems), problems)
+	}
+
+	for _, e := range exp {
+		var found bool
+		for _, p := range problems {
+			if strings.Contains(p, e) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected problem '%s' in %v", e, problems)
+		}
+	}
+}
+
+func TestCheckConfKeysTemplates(t *testing.T) {
+	tmpl := newTempl(map[string]string{
+		"AppName":     "Test App",
+		"AppNameSlug": "test_app",
+	})
+
+	for _, fn := range []string{"dev.yml", "prod.yml"} {
+		b, err := tmpl.get(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vi := newViper("./", "dev")
+		vi.SetConfigType("yaml")
+
+		if err := vi.ReadConfig(bytes.NewReader(b)); err != nil {
+			t.Fatal(err)
+		}
+
+		if problems := checkConfKeys(vi); len(problems) != 0 {
+			t.Errorf("%s: %v", fn, problems)
+		}
+	}
+}
+
+func TestDumpConf(t *testing.T) {
+	c := &Config{}
+	c.AppName = "Test"
+	c.SecretKey = "cursor-secret"
+	c.DB.Type = "postgres"
+	c.DB.Password = "db-pass"
+	c.Auth.Type = "jwt"
+	c.Auth.JWT.Secret = "jwt-secret"
+	c.Auth.JWT.Leeway = 30 * time.Second
+	c.RateLimiter.Redis.URL = "redis://:redis-pass@localhost:6379"
+	c.Actions = []Action{{Name: "notify"}}
+	c.Actions[0].Webhook.Headers = map[string]string{"Authorization": "Bearer token"}
+
+	conf := dumpConf(c)
+
+	for _, fn := range []func(interface{}) ([]byte, error){yaml.Marshal, json.Marshal} {
+		b, err := fn(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := string(b)
+
+		for _, v := range []string{"cursor-secret", "db-pass", "jwt-secret", "redis-pass", "Bearer token"} {
+			if strings.Contains(out, v) {
+				t.Errorf("expected '%s' to be masked:\n%s", v, out)
+			}
+		}
+	}
+
+	if conf["app_name"] != "Test" || conf["secret_key"] != confMask {
+		t.Errorf("expected the squashed core and serv values: %v", conf)
+	}
+
+	db, _ := conf["database"].(map[string]interface{})
+
+	if db["type"] != "postgres" || db["password"] != confMask {
+		t.Errorf("unexpected database config: %v", db)
+	}
+
+	jwt := conf["auth"].(map[string]interface{})["jwt"].(map[string]interface{})
+
+	if jwt["leeway"] != "30s" {
+		t.Errorf("expected the duration as a string got %v", jwt["leeway"])
+	}
+
+	redis := conf["rate_limiter"].(map[string]interface{})["redis"].(map[string]interface{})
+
+	if redis["url"] != "redis://:"+confMask+"@localhost:6379" {
+		t.Errorf("expected the url password to be masked got %v", redis["url"])
+	}
+}
@@ -0,0 +1,109 @@
+package serv
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func cmdEventsList(servConf *ServConfig) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		initConfOnce(servConf)
+
+		status := evDead
+		if len(args) != 0 {
+			status = args[0]
+		}
+
+		switch status {
+		case evPending, evDelivered, evDead:
+		default:
+			servConf.log.Fatalf("Invalid event status: %s", status)
+		}
+
+		db, err := initDB(servConf, true, false)
+		if err != nil {
+			servConf.log.Fatalf("Failed to connect to database: %s", err)
+		}
+		defer db.Close()
+
+		rows, err := db.Query(fmt.Sprintf(`
+			SELECT id, trigger_name, table_name, op, attempts, created_at, last_error
+			FROM %s WHERE status = $1 ORDER BY id DESC LIMIT 100`,
+			outboxTable(servConf.conf)), status)
+		if err != nil {
+			servConf.log.Fatalf("Failed to list events: %s", err)
+		}
+		defer rows.Close()
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tTRIGGER\tTABLE\tOP\tATTEMPTS\tCREATED\tLAST ERROR")
+
+		for rows.Next() {
+			var id int64
+			var trigger, table, op string
+			var attempts int
+			var created time.Time
+			var lastErr sql.NullString
+
+			if err := rows.Scan(&id, &trigger, &table, &op, &attempts, &created, &lastErr); err != nil {
+				servConf.log.Fatalf("Failed to list events: %s", err)
+			}
+
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%s\t%s\n",
+				id, trigger, table, op, attempts, created.Format(time.RFC3339), lastErr.String)
+		}
+
+		if err := rows.Err(); err != nil {
+			servConf.log.Fatalf("Failed to list events: %s", err)
+		}
+		tw.Flush()
+	}
+}
+
+func cmdEventsRetry(servConf *ServConfig) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		var res sql.Result
+
+		if len(args) == 0 {
+			cmd.Help() //nolint: errcheck
+			os.Exit(1)
+		}
+
+		initConfOnce(servConf)
+
+		db, err := initDB(servConf, true, false)
+		if err != nil {
+			servConf.log.Fatalf("Failed to connect to database: %s", err)
+		}
+		defer db.Close()
+
+		q := fmt.Sprintf(`UPDATE %s SET status = 'pending', attempts = 0,
+			next_attempt_at = now() WHERE status = 'dead'`, outboxTable(servConf.conf))
+
+		if args[0] == "all" {
+			res, err = db.Exec(q)
+		} else {
+			ids := make([]int64, len(args))
+
+			for i, v := range args {
+				if ids[i], err = strconv.ParseInt(v, 10, 64); err != nil {
+					servConf.log.Fatalf("Invalid event id: %s", v)
+				}
+			}
+			res, err = db.Exec(q+` AND id = ANY($1)`, ids)
+		}
+
+		if err != nil {
+			servConf.log.Fatalf("Failed to retry events: %s", err)
+		}
+
+		n, _ := res.RowsAffected()
+		servConf.log.Infof("%d dead event(s) queued for delivery", n)
+	}
+}
@@ -0,0 +1,122 @@
+package serv
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/dosco/graphjin/core"
+	"github.com/spf13/cobra"
+)
+
+type explainOpts struct {
+	file    string
+	vars    string
+	role    string
+	userID  string
+	all     bool
+	json    bool
+	minRows float64
+}
+
+func explainCmd(servConf *ServConfig) *cobra.Command {
+	var opts explainOpts
+
+	c := &cobra.Command{
+		Use:   "explain [QUERY]",
+		Short: "Show the SQL and query plan for a query",
+		Long: `Compile a GraphQL query for a role and show the generated SQL along with the
+plan from EXPLAIN ANALYZE. Sequential scans on large tables and join columns
+without an index are flagged. Queries are run in a transaction that is rolled back,
+mutations are only planned.
+
+The query is taken from the argument, the file set with --file or stdin.
+Use --all to explain every query and mutation in the allow list.
+e.g. graphjin explain --role user --user-id 1 '{ me { email purchases { id } } }'
+e.g. graphjin explain --all`,
+		Args: cobra.MaximumNArgs(1),
+		Run:  cmdExplain(servConf, &opts),
+	}
+
+	f := c.Flags()
+	f.StringVarP(&opts.file, "file", "f", "", "read the query from a file")
+	f.StringVar(&opts.vars, "vars", "", "query variables as json")
+	f.StringVar(&opts.role, "role", "user", "compile the query for this role")
+	f.StringVar(&opts.userID, "user-id", "", "run the query as this user id")
+	f.BoolVar(&opts.all, "all", false, "explain all the queries in the allow list")
+	f.BoolVar(&opts.json, "json", false, "print the report as json")
+	f.Float64Var(&opts.minRows, "min-rows", explainMinRows,
+		"flag sequential scans on tables with at least these many rows")
+
+	return c
+}
+
+func cmdExplain(servConf *ServConfig, opts *explainOpts) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		var query string
+		var vars json.RawMessage
+		var err error
+
+		if opts.all && (len(args) != 0 || opts.file != "") {
+			servConf.log.Fatalf("Use either a query or --all")
+		}
+
+		if !opts.all {
+			if query, err = readQuery(args, opts.file, os.Stdin); err != nil {
+				servConf.log.Fatalf("Failed to read query: %s", err)
+			}
+		}
+
+		if opts.vars != "" {
+			if !json.Valid([]byte(opts.vars)) {
+				servConf.log.Fatalf("Failed to parse variables: invalid json")
+			}
+			vars = json.RawMessage(opts.vars)
+		}
+
+		initConfOnce(servConf)
+
+		if servConf.conf.DB.Type == "mysql" {
+			servConf.log.Fatalf("Explain is not supported with MySQL")
+		}
+
+		servConf.db, err = initDB(servConf, true, false)
+		if err != nil {
+			servConf.log.Fatalf("Failed to connect to database: %s", err)
+		}
+		defer servConf.db.Close()
+
+		gj, err = core.NewGraphJin(&servConf.conf.Core, servConf.db)
+		if err != nil {
+			servConf.log.Fatalf("GraphJin failed to initialize: %s", err)
+		}
+
+		c := context.Background()
+
+		if opts.userID != "" {
+			c = context.WithValue(c, core.UserIDKey, opts.userID)
+		}
+
+		var reps []explainReport
+
+		if opts.all {
+			reps = explainAllowList(c, servConf, opts.role, opts.minRows)
+		} else {
+			reps = append(reps, explainQuery(c, servConf, query, vars, opts.role, opts.minRows))
+		}
+
+		if opts.json {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+
+			if err := enc.Encode(reps); err != nil {
+				servConf.log.Fatalf("Failed to encode report: %s", err)
+			}
+			return
+		}
+
+		for _, rep := range reps {
+			writeReport(os.Stdout, rep)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package serv
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func cmdJobsHistory(servConf *ServConfig) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		var rows *sql.Rows
+
+		initConfOnce(servConf)
+
+		db, err := initDB(servConf, true, false)
+		if err != nil {
+			servConf.log.Fatalf("Failed to connect to database: %s", err)
+		}
+		defer db.Close()
+
+		q := fmt.Sprintf(`SELECT id, job_name, status, started_at, finished_at, error FROM %s`,
+			quoteIdent(jobRunsTable))
+
+		if len(args) != 0 {
+			rows, err = db.Query(q+` WHERE job_name = $1 ORDER BY id DESC LIMIT 100`, args[0])
+		} else {
+			rows, err = db.Query(q + ` ORDER BY id DESC LIMIT 100`)
+		}
+
+		if err != nil {
+			servConf.log.Fatalf("Failed to list job runs: %s", err)
+		}
+		defer rows.Close()
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tJOB\tSTATUS\tSTARTED\tDURATION\tERROR")
+
+		for rows.Next() {
+			var id int64
+			var name, status string
+			var started time.Time
+			var finished sql.NullTime
+			var jobErr sql.NullString
+
+			if err := rows.Scan(&id, &name, &status, &started, &finished, &jobErr); err != nil {
+				servConf.log.Fatalf("Failed to list job runs: %s", err)
+			}
+
+			var dur string
+			if finished.Valid {
+				dur = finished.Time.Sub(started).Round(time.Millisecond).String()
+			}
+
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n",
+				id, name, status, started.Format(time.RFC3339), dur, jobErr.String)
+		}
+
+		if err := rows.Err(); err != nil {
+			servConf.log.Fatalf("Failed to list job runs: %s", err)
+		}
+		tw.Flush()
+	}
+}
@@ -0,0 +1,152 @@
+package serv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/dosco/graphjin/core"
+	"github.com/spf13/cobra"
+)
+
+type queryOpts struct {
+	file   string
+	vars   string
+	role   string
+	userID string
+	sql    bool
+	timing bool
+}
+
+func queryCmd(servConf *ServConfig) *cobra.Command {
+	var opts queryOpts
+
+	c := &cobra.Command{
+		Use:   "query [QUERY]",
+		Short: "Run a GraphQL query",
+		Long: `Run a GraphQL query or mutation against the configured database and print the result.
+
+The query is taken from the argument, the file set with --file or stdin.
+e.g. graphjin query '{ products(limit: 5) { id name } }'
+e.g. echo '{ me { email } }' | graphjin query --user-id 1`,
+		Args: cobra.MaximumNArgs(1),
+		Run:  cmdQuery(servConf, &opts),
+	}
+
+	f := c.Flags()
+	f.StringVarP(&opts.file, "file", "f", "", "read the query from a file")
+	f.StringVar(&opts.vars, "vars", "", "query variables as json")
+	f.StringVar(&opts.role, "role", "", "run the query as this role")
+	f.StringVar(&opts.userID, "user-id", "", "run the query as this user id")
+	f.BoolVar(&opts.sql, "sql", false, "print the generated sql")
+	f.BoolVar(&opts.timing, "timing", false, "print the query execution time")
+
+	return c
+}
+
+func cmdQuery(servConf *ServConfig, opts *queryOpts) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		query, err := readQuery(args, opts.file, os.Stdin)
+		if err != nil {
+			servConf.log.Fatalf("Failed to read query: %s", err)
+		}
+
+		var vars json.RawMessage
+
+		if opts.vars != "" {
+			if !json.Valid([]byte(opts.vars)) {
+				servConf.log.Fatalf("Failed to parse variables: invalid json")
+			}
+			vars = json.RawMessage(opts.vars)
+		}
+
+		initConfOnce(servConf)
+
+		// do not save queries run from the command line to the allow list
+		if !servConf.conf.Production {
+			servConf.conf.DisableAllowList = true
+		}
+
+		servConf.db, err = initDB(servConf, true, false)
+		if err != nil {
+			servConf.log.Fatalf("Failed to connect to database: %s", err)
+		}
+		defer servConf.db.Close()
+
+		gj, err = core.NewGraphJin(&servConf.conf.Core, servConf.db)
+		if err != nil {
+			servConf.log.Fatalf("GraphJin failed to initialize: %s", err)
+		}
+
+		c := context.Background()
+
+		if opts.userID != "" {
+			c = context.WithValue(c, core.UserIDKey, opts.userID)
+		}
+
+		if opts.role != "" {
+			c = context.WithValue(c, core.UserRoleKey, opts.role)
+		}
+
+		st := time.Now()
+		res, err := gj.GraphQL(c, query, vars)
+		dur := time.Since(st)
+
+		if opts.sql && res.SQL() != "" {
+			fmt.Fprintf(os.Stderr, "%s\n\n", res.SQL())
+		}
+
+		if opts.timing {
+			fmt.Fprintf(os.Stderr, "Time: %s\n\n", dur.Round(time.Microsecond))
+		}
+
+		b, err1 := json.MarshalIndent(res, "", "  ")
+		if err1 != nil {
+			servConf.log.Fatalf("Failed to encode result: %s", err1)
+		}
+		fmt.Println(string(b))
+
+		if err != nil {
+			servConf.log.Fatalf("Query failed: %s", err)
+		}
+	}
+}
+
+// readQuery returns the query from the command argument,
+// the query file or stdin in that order.
+func readQuery(args []string, file string, stdin io.Reader) (string, error) {
+	var b []byte
+	var err error
+
+	switch {
+	case len(args) != 0 && file != "":
+		return "", errors.New("use either a query argument or --file")
+
+	case len(args) != 0:
+		b = []byte(args[0])
+
+	case file != "":
+		b, err = ioutil.ReadFile(file)
+
+	default:
+		b, err = ioutil.ReadAll(stdin)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	b = bytes.TrimSpace(b)
+
+	if len(b) == 0 {
+		return "", errors.New("query is empty")
+	}
+
+	return string(b), nil
+}
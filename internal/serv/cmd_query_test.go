@@ -0,0 +1,55 @@
+package serv
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "graphjin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "query.gql")
+
+	if err := ioutil.WriteFile(file, []byte("\n{ users { id } }\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdin := strings.NewReader(" { products { id } } ")
+
+	tests := []struct {
+		args []string
+		file string
+		exp  string
+		err  bool
+	}{
+		{args: []string{"{ me { id } }"}, exp: "{ me { id } }"},
+		{file: file, exp: "{ users { id } }"},
+		{exp: "{ products { id } }"},
+		{args: []string{"{ me { id } }"}, file: file, err: true},
+		{args: []string{"  "}, err: true},
+	}
+
+	for i, tt := range tests {
+		q, err := readQuery(tt.args, tt.file, stdin)
+
+		if tt.err {
+			if err == nil {
+				t.Errorf("%d: expected an error", i)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%d: %s", i, err)
+		} else if q != tt.exp {
+			t.Errorf("%d: expected '%s' got '%s'", i, tt.exp, q)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/dosco/graphjin/internal/envsubst"
 	"github.com/spf13/viper"
 )
 
@@ -45,7 +46,7 @@ func ReadInConfig(configFile string) (*Config, error) {
 
 	c := &Config{cpath: cpath, vi: vi}
 
-	if err := vi.Unmarshal(&c); err != nil {
+	if err := vi.Unmarshal(&c, envsubst.DecoderOption); err != nil {
 		return nil, fmt.Errorf("failed to decode config, %v", err)
 	}
 
@@ -131,3 +132,16 @@ func (c *Config) relPath(p string) string {
 func (c *Config) rateLimiterEnable() bool {
 	return c.RateLimiter.Rate > 0 && c.RateLimiter.Bucket > 0
 }
+
+// addCloseFn adds a function to be called on shutdown, functions
+// run in the reverse order they were added.
+func (c *Config) addCloseFn(fn func()) {
+	closeFn := c.closeFn
+
+	c.closeFn = func() {
+		fn()
+		if closeFn != nil {
+			closeFn()
+		}
+	}
+}
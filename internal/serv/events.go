@@ -0,0 +1,572 @@
+package serv
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultEventsTable        = "graphjin_events"
+	defaultEventsPollEvery    = 2 * time.Second
+	defaultEventsBatchSize    = 50
+	defaultEventsMaxRetries   = 8
+	defaultEventsRetryBackoff = 5 * time.Second
+	defaultWebhookTimeout     = 10 * time.Second
+	maxEventsRetryBackoff     = time.Hour
+)
+
+// Event delivery states, events that fail delivery more than the
+// max retries are marked dead and can be requeued using the cli
+const (
+	evPending   = "pending"
+	evDelivered = "delivered"
+	evDead      = "dead"
+)
+
+var identRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+type outboxEvent struct {
+	ID        int64
+	Trigger   string
+	Table     string
+	Op        string
+	Mutation  sql.NullString
+	OldRow    []byte
+	NewRow    []byte
+	Attempts  int
+	CreatedAt time.Time
+}
+
+type eventPayload struct {
+	ID        int64     `json:"id"`
+	Trigger   string    `json:"trigger"`
+	Table     string    `json:"table"`
+	Op        string    `json:"op"`
+	Mutation  string    `json:"mutation,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      struct {
+		Old json.RawMessage `json:"old"`
+		New json.RawMessage `json:"new"`
+	} `json:"data"`
+}
+
+type eventWorker struct {
+	sc       *ServConfig
+	triggers map[string]*EventTrigger
+	client   *http.Client
+
+	// how long claimed events are hidden from other workers
+	lease time.Duration
+}
+
+func initEventTriggers(c *Config) error {
+	ec := &c.Events
+
+	if ec.OutboxTable == "" {
+		ec.OutboxTable = defaultEventsTable
+	}
+
+	if ec.PollEvery == 0 {
+		ec.PollEvery = defaultEventsPollEvery
+	}
+
+	if ec.BatchSize == 0 {
+		ec.BatchSize = defaultEventsBatchSize
+	}
+
+	if ec.MaxRetries == 0 {
+		ec.MaxRetries = defaultEventsMaxRetries
+	}
+
+	if ec.RetryBackoff == 0 {
+		ec.RetryBackoff = defaultEventsRetryBackoff
+	}
+
+	if len(c.EventTriggers) == 0 {
+		return nil
+	}
+
+	if c.DBType == "mysql" {
+		return errors.New("event triggers are not supported with MySQL")
+	}
+
+	if !identRe.MatchString(ec.OutboxTable) {
+		return fmt.Errorf("Invalid events outbox table: %s", ec.OutboxTable)
+	}
+
+	tm := make(map[string]struct{})
+
+	for i := 0; i < len(c.EventTriggers); i++ {
+		t := &c.EventTriggers[i]
+
+		if !identRe.MatchString(t.Name) {
+			return fmt.Errorf("Invalid event trigger name: '%s'", t.Name)
+		}
+
+		if _, ok := tm[t.Name]; ok {
+			return fmt.Errorf("Duplicate event trigger found: %s", t.Name)
+		}
+		tm[t.Name] = struct{}{}
+
+		if t.Schema == "" {
+			t.Schema = c.DB.Schema
+		}
+
+		if !identRe.MatchString(t.Table) || !identRe.MatchString(t.Schema) {
+			return fmt.Errorf("Invalid table: %s.%s, For event trigger: %s", t.Schema, t.Table, t.Name)
+		}
+
+		if len(t.Operations) == 0 {
+			return fmt.Errorf("No operations defined, For event trigger: %s", t.Name)
+		}
+
+		for j, op := range t.Operations {
+			op = strings.ToLower(op)
+
+			switch op {
+			case "insert", "update", "delete":
+				t.Operations[j] = op
+			default:
+				return fmt.Errorf("Invalid operation: %s, For event trigger: %s", op, t.Name)
+			}
+		}
+
+		for _, col := range t.Columns {
+			if !identRe.MatchString(col) {
+				return fmt.Errorf("Invalid column: %s, For event trigger: %s", col, t.Name)
+			}
+		}
+
+		if t.Webhook.URL == "" {
+			return fmt.Errorf("No webhook url defined, For event trigger: %s", t.Name)
+		}
+
+		if t.Webhook.Timeout == 0 {
+			t.Webhook.Timeout = defaultWebhookTimeout
+		}
+	}
+
+	// mutations are marked so the triggers only
+	// record changes made through GraphJin
+	c.Core.MarkMutations = true
+
+	return nil
+}
+
+// outboxTable returns the schema qualified outbox table
+func outboxTable(c *Config) string {
+	return quoteIdent(eventSchema(c)) + "." + quoteIdent(c.Events.OutboxTable)
+}
+
+// eventFunc returns the schema qualified function called by the triggers
+func eventFunc(c *Config) string {
+	return quoteIdent(eventSchema(c)) + ".graphjin_record_event"
+}
+
+// eventSchema returns the schema of the outbox table and the trigger
+// function, it's the schema GraphJin is configured to use
+func eventSchema(c *Config) string {
+	if c.DB.Schema != "" {
+		return c.DB.Schema
+	}
+	return "public"
+}
+
+// setupEventTriggers creates the outbox table and replaces all existing
+// GraphJin triggers with the ones defined in the config. An advisory lock
+// keeps instances starting at the same time from changing them together.
+func setupEventTriggers(sc *ServConfig) error {
+	ec := &sc.conf.Events
+	c := context.Background()
+	table := outboxTable(sc.conf)
+	fn := eventFunc(sc.conf)
+
+	tx, err := sc.db.BeginTx(c, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint: errcheck
+
+	_, err = tx.ExecContext(c, `SELECT pg_advisory_xact_lock(hashtext($1))`,
+		"graphjin:events:"+ec.OutboxTable)
+	if err != nil {
+		return err
+	}
+
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id              bigserial PRIMARY KEY,
+			trigger_name    text NOT NULL,
+			table_name      text NOT NULL,
+			op              text NOT NULL,
+			mutation        text,
+			old_row         json,
+			new_row         json,
+			status          text NOT NULL DEFAULT 'pending',
+			attempts        integer NOT NULL DEFAULT 0,
+			last_error      text,
+			next_attempt_at timestamptz NOT NULL DEFAULT now(),
+			delivered_at    timestamptz,
+			created_at      timestamptz NOT NULL DEFAULT now()
+		)`, table),
+
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (next_attempt_at)
+			WHERE status = 'pending'`, quoteIdent(ec.OutboxTable+"_pending"), table),
+
+		// the function runs as its owner with a fixed search path so the
+		// database roles switched to for mutations do not need access to
+		// the outbox table
+		fmt.Sprintf(`CREATE OR REPLACE FUNCTION %s() RETURNS trigger AS $$
+		DECLARE
+			old_row json;
+			new_row json;
+		BEGIN
+			IF TG_OP <> 'INSERT' THEN
+				old_row := row_to_json(OLD);
+			END IF;
+			IF TG_OP <> 'DELETE' THEN
+				new_row := row_to_json(NEW);
+			END IF;
+			INSERT INTO %s (trigger_name, table_name, op, mutation, old_row, new_row)
+			VALUES (TG_ARGV[0], TG_TABLE_NAME, lower(TG_OP),
+				current_setting('graphjin.mutation', true), old_row, new_row);
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql SECURITY DEFINER SET search_path = pg_catalog, pg_temp`, fn, table),
+	}
+
+	for _, s := range stmts {
+		if _, err := tx.ExecContext(c, s); err != nil {
+			return err
+		}
+	}
+
+	if err := dropEventTriggers(c, tx, sc.conf.EventTriggers); err != nil {
+		return err
+	}
+
+	for _, t := range sc.conf.EventTriggers {
+		for _, op := range t.Operations {
+			if _, err := tx.ExecContext(c, eventTriggerSQL(t, op, fn)); err != nil {
+				return fmt.Errorf("event trigger %s: %w", t.Name, err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// dropEventTriggers drops the GraphJin triggers on the tables of the event triggers
+func dropEventTriggers(c context.Context, tx *sql.Tx, triggers []EventTrigger) error {
+	var drop, tables []string
+
+	for _, t := range triggers {
+		tables = append(tables, quoteIdent(t.Schema)+"."+quoteIdent(t.Table))
+	}
+
+	rows, err := tx.QueryContext(c, `
+		SELECT n.nspname, c.relname, t.tgname
+		FROM pg_trigger t
+		JOIN pg_class c ON c.oid = t.tgrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE NOT t.tgisinternal AND t.tgname LIKE 'graphjin\_ev\_%'
+		AND t.tgrelid IN (SELECT to_regclass(v) FROM unnest(string_to_array($1, ',')) AS v)`,
+		strings.Join(tables, ","))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schema, table, name string
+
+		if err := rows.Scan(&schema, &table, &name); err != nil {
+			return err
+		}
+		drop = append(drop, fmt.Sprintf(`DROP TRIGGER IF EXISTS %s ON %s.%s`,
+			quoteIdent(name), quoteIdent(schema), quoteIdent(table)))
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, s := range drop {
+		if _, err := tx.ExecContext(c, s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// eventTriggerSQL renders the trigger for a single operation calling the function
+// fn, changes not made by a GraphJin mutation are skipped.
+func eventTriggerSQL(t EventTrigger, op, fn string) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, `CREATE TRIGGER %s AFTER %s ON %s.%s FOR EACH ROW `,
+		quoteIdent("graphjin_ev_"+t.Name+"_"+op), strings.ToUpper(op),
+		quoteIdent(t.Schema), quoteIdent(t.Table))
+
+	sb.WriteString(`WHEN (coalesce(current_setting('graphjin.mutation', true), '') <> ''`)
+
+	if op == "update" && len(t.Columns) != 0 {
+		sb.WriteString(` AND (`)
+		for i, col := range t.Columns {
+			if i != 0 {
+				sb.WriteString(` OR `)
+			}
+			fmt.Fprintf(&sb, `OLD.%[1]s IS DISTINCT FROM NEW.%[1]s`, quoteIdent(col))
+		}
+		sb.WriteString(`)`)
+	}
+
+	fmt.Fprintf(&sb, `) EXECUTE PROCEDURE %s('%s')`, fn, t.Name)
+
+	return sb.String()
+}
+
+// startEventWorker delivers pending events from the outbox table till
+// the returned stop function is called. Events are claimed before being
+// delivered so many instances of the service can share the same outbox.
+func startEventWorker(sc *ServConfig) func() {
+	w := &eventWorker{
+		sc:       sc,
+		triggers: make(map[string]*EventTrigger),
+		client:   &http.Client{},
+	}
+
+	var timeout time.Duration
+
+	for i := range sc.conf.EventTriggers {
+		t := &sc.conf.EventTriggers[i]
+		w.triggers[t.Name] = t
+
+		if t.Webhook.Timeout > timeout {
+			timeout = t.Webhook.Timeout
+		}
+	}
+
+	// the lease covers delivering a full batch, events of a
+	// worker that stopped are retried once it expires
+	w.lease = time.Duration(sc.conf.Events.BatchSize)*timeout + sc.conf.Events.PollEvery
+
+	c, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(sc.conf.Events.PollEvery)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-c.Done():
+				return
+			case <-t.C:
+			}
+
+			// keep going while there are full batches waiting
+			for {
+				n, err := w.deliverBatch(c)
+				if err != nil && c.Err() == nil {
+					sc.zlog.Error("Event delivery", zap.Error(err))
+				}
+				if err != nil || n < sc.conf.Events.BatchSize {
+					break
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// deliverBatch claims a batch of pending events by moving their next attempt past
+// the lease, the events are then delivered outside of any transaction and
+// their status updated. Claiming is a single statement so the rows are
+// only locked for as long as it runs.
+func (w *eventWorker) deliverBatch(c context.Context) (int, error) {
+	ec := &w.sc.conf.Events
+	table := outboxTable(w.sc.conf)
+
+	rows, err := w.sc.db.QueryContext(c, fmt.Sprintf(`
+		UPDATE %[1]s SET next_attempt_at = now() + $2 * interval '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM %[1]s
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING id, trigger_name, table_name, op, mutation, old_row, new_row, attempts, created_at`,
+		table), ec.BatchSize, w.lease.Milliseconds())
+	if err != nil {
+		return 0, err
+	}
+
+	var evs []outboxEvent
+
+	for rows.Next() {
+		var ev outboxEvent
+
+		err := rows.Scan(&ev.ID, &ev.Trigger, &ev.Table, &ev.Op, &ev.Mutation,
+			&ev.OldRow, &ev.NewRow, &ev.Attempts, &ev.CreatedAt)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		evs = append(evs, ev)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sort.Slice(evs, func(i, j int) bool { return evs[i].ID < evs[j].ID })
+
+	for _, ev := range evs {
+		var err error
+
+		if t, ok := w.triggers[ev.Trigger]; ok {
+			err = w.deliver(c, t, ev)
+		} else {
+			err = fmt.Errorf("event trigger not found: %s", ev.Trigger)
+		}
+
+		if err := w.updateEvent(c, ev, err); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(evs), nil
+}
+
+func (w *eventWorker) updateEvent(c context.Context, ev outboxEvent, derr error) error {
+	ec := &w.sc.conf.Events
+	db := w.sc.db
+
+	if derr == nil {
+		_, err := db.ExecContext(c, fmt.Sprintf(`
+			UPDATE %s SET status = 'delivered', attempts = attempts + 1,
+			last_error = NULL, delivered_at = now() WHERE id = $1`, outboxTable(w.sc.conf)), ev.ID)
+		return err
+	}
+
+	status := evPending
+	if ev.Attempts+1 >= ec.MaxRetries {
+		status = evDead
+	}
+
+	backoff := eventBackoff(ec.RetryBackoff, ev.Attempts)
+
+	w.sc.zlog.Warn("Event delivery failed",
+		zap.Int64("id", ev.ID),
+		zap.String("trigger", ev.Trigger),
+		zap.String("status", status),
+		zap.Error(derr))
+
+	_, err := db.ExecContext(c, fmt.Sprintf(`
+		UPDATE %s SET status = $2, attempts = attempts + 1, last_error = $3,
+		next_attempt_at = now() + $4 * interval '1 millisecond' WHERE id = $1`, outboxTable(w.sc.conf)),
+		ev.ID, status, derr.Error(), backoff.Milliseconds())
+	return err
+}
+
+func (w *eventWorker) deliver(c context.Context, t *EventTrigger, ev outboxEvent) error {
+	p := eventPayload{
+		ID:        ev.ID,
+		Trigger:   ev.Trigger,
+		Table:     ev.Table,
+		Op:        ev.Op,
+		Mutation:  ev.Mutation.String,
+		CreatedAt: ev.CreatedAt,
+	}
+	p.Data.Old = ev.OldRow
+	p.Data.New = ev.NewRow
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	c, cancel := context.WithTimeout(c, t.Webhook.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequest("POST", t.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(c)
+
+	for k, v := range t.Webhook.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GraphJin-Event-ID", fmt.Sprintf("%d", ev.ID))
+	req.Header.Set("X-GraphJin-Trigger", ev.Trigger)
+
+	if t.Webhook.Secret != "" {
+		req.Header.Set("X-GraphJin-Signature", signEvent(t.Webhook.Secret, body))
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, maxReadBytes)) //nolint: errcheck
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status: %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// signEvent returns the hex encoded HMAC-SHA256 of the event body
+// which webhooks can use to verify the event came from GraphJin.
+func signEvent(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body) //nolint: errcheck
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// eventBackoff doubles the wait after each failed attempt.
+func eventBackoff(base time.Duration, attempts int) time.Duration {
+	d := base
+	for i := 0; i < attempts && d < maxEventsRetryBackoff; i++ {
+		d *= 2
+	}
+
+	if d > maxEventsRetryBackoff {
+		d = maxEventsRetryBackoff
+	}
+	return d
+}
@@ -0,0 +1,101 @@
+package serv
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInitEventTriggers(t *testing.T) {
+	c := &Config{}
+	c.DB.Schema = "public"
+	c.EventTriggers = []EventTrigger{{
+		Name:       "new_user",
+		Table:      "users",
+		Operations: []string{"INSERT", "update"},
+		Columns:    []string{"email"},
+	}}
+	c.EventTriggers[0].Webhook.URL = "http://localhost/hook"
+
+	if err := initEventTriggers(c); err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.MarkMutations {
+		t.Error("expected mutations to be marked")
+	}
+
+	et := c.EventTriggers[0]
+
+	if et.Schema != "public" || et.Operations[0] != "insert" {
+		t.Errorf("event trigger not sanitized: %+v", et)
+	}
+
+	if c.Events.OutboxTable != defaultEventsTable || et.Webhook.Timeout != defaultWebhookTimeout {
+		t.Error("expected defaults to be set")
+	}
+
+	c.EventTriggers = append(c.EventTriggers, c.EventTriggers[0])
+
+	if err := initEventTriggers(c); err == nil {
+		t.Error("expected duplicate event trigger error")
+	}
+
+	c.EventTriggers = c.EventTriggers[:1]
+	c.EventTriggers[0].Columns = []string{`email"; drop table users; --`}
+
+	if err := initEventTriggers(c); err == nil {
+		t.Error("expected invalid column error")
+	}
+}
+
+func TestEventTriggerSQL(t *testing.T) {
+	et := EventTrigger{
+		Name:    "user_email",
+		Table:   "users",
+		Schema:  "public",
+		Columns: []string{"email", "full_name"},
+	}
+
+	exp := `CREATE TRIGGER "graphjin_ev_user_email_update" AFTER UPDATE ON "public"."users" FOR EACH ROW ` +
+		`WHEN (coalesce(current_setting('graphjin.mutation', true), '') <> '' AND ` +
+		`(OLD."email" IS DISTINCT FROM NEW."email" OR OLD."full_name" IS DISTINCT FROM NEW."full_name")) ` +
+		`EXECUTE PROCEDURE "public".graphjin_record_event('user_email')`
+
+	if v := eventTriggerSQL(et, "update", `"public".graphjin_record_event`); v != exp {
+		t.Errorf("expected:\n%s\ngot:\n%s", exp, v)
+	}
+
+	exp = `CREATE TRIGGER "graphjin_ev_user_email_insert" AFTER INSERT ON "public"."users" FOR EACH ROW ` +
+		`WHEN (coalesce(current_setting('graphjin.mutation', true), '') <> '') ` +
+		`EXECUTE PROCEDURE "public".graphjin_record_event('user_email')`
+
+	if v := eventTriggerSQL(et, "insert", `"public".graphjin_record_event`); v != exp {
+		t.Errorf("expected:\n%s\ngot:\n%s", exp, v)
+	}
+}
+
+func TestEventBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		exp      time.Duration
+	}{
+		{0, 5 * time.Second},
+		{1, 10 * time.Second},
+		{3, 40 * time.Second},
+		{20, maxEventsRetryBackoff},
+	}
+
+	for _, v := range tests {
+		if d := eventBackoff(5*time.Second, v.attempts); d != v.exp {
+			t.Errorf("attempts %d: expected %s got %s", v.attempts, v.exp, d)
+		}
+	}
+}
+
+func TestSignEvent(t *testing.T) {
+	exp := "sha256=77325902caca812dc259733aacd046b73817372c777b8d95b402647474516e13"
+
+	if v := signEvent("secret", []byte(`{}`)); v != exp {
+		t.Errorf("expected %s got %s", exp, v)
+	}
+}
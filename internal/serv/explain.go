@@ -0,0 +1,312 @@
+package serv
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/dosco/graphjin/core"
+	"github.com/dosco/graphjin/internal/serv/internal/auth"
+)
+
+const (
+	// tables with fewer rows are not flagged for sequential scans
+	explainMinRows = 10000
+)
+
+type explainReport struct {
+	Name     string          `json:"name,omitempty"`
+	Role     string          `json:"role"`
+	SQL      string          `json:"sql,omitempty"`
+	Plan     json.RawMessage `json:"plan,omitempty"`
+	Warnings []string        `json:"warnings,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+type explainPlan struct {
+	Plan          planNode `json:"Plan"`
+	PlanningTime  float64  `json:"Planning Time"`
+	ExecutionTime float64  `json:"Execution Time"`
+}
+
+type planNode struct {
+	NodeType    string     `json:"Node Type"`
+	Schema      string     `json:"Schema"`
+	Relation    string     `json:"Relation Name"`
+	Alias       string     `json:"Alias"`
+	IndexName   string     `json:"Index Name"`
+	ActualRows  float64    `json:"Actual Rows"`
+	ActualLoops float64    `json:"Actual Loops"`
+	ActualTime  float64    `json:"Actual Total Time"`
+	PlanRows    float64    `json:"Plan Rows"`
+	Plans       []planNode `json:"Plans"`
+}
+
+type scanTable struct {
+	Schema string
+	Name   string
+}
+
+func (t scanTable) String() string {
+	if t.Schema == "" {
+		return t.Name
+	}
+	return t.Schema + "." + t.Name
+}
+
+// explainQuery runs explain on the query and checks the plan for
+// sequential scans on large tables and join columns without an index
+func explainQuery(
+	c context.Context,
+	sc *ServConfig,
+	query string,
+	vars json.RawMessage,
+	role string,
+	minRows float64) explainReport {
+
+	rep := explainReport{Role: role}
+
+	qp, err := gj.Explain(c, query, vars, role)
+	if qp != nil {
+		rep.Name = qp.Name
+		rep.Role = qp.Role
+		rep.SQL = qp.SQL
+		rep.Plan = qp.Plan
+	}
+
+	if err == nil {
+		rep.Warnings, err = planWarnings(c, sc.db, qp, minRows)
+	}
+
+	if err != nil {
+		rep.Error = err.Error()
+	}
+
+	return rep
+}
+
+// explainAllowList explains all the named queries and mutations in the allow list
+func explainAllowList(c context.Context, sc *ServConfig, role string, minRows float64) []explainReport {
+	var reps []explainReport
+
+	for _, nq := range gj.NamedQueries() {
+		if nq.Operation == core.OpSubscription {
+			continue
+		}
+		reps = append(reps, explainQuery(c, sc, nq.Query, nil, role, minRows))
+	}
+
+	return reps
+}
+
+func planWarnings(c context.Context, db *sql.DB, qp *core.QueryPlan, minRows float64) ([]string, error) {
+	var warns []string
+
+	tables, err := seqScans(qp.Plan)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range tables {
+		var rows float64
+		name := quoteIdent(t.Name)
+
+		if t.Schema != "" {
+			name = quoteIdent(t.Schema) + "." + name
+		}
+
+		err := db.QueryRowContext(c,
+			`SELECT coalesce(max(reltuples), 0) FROM pg_class WHERE oid = to_regclass($1)`,
+			name).Scan(&rows)
+		if err != nil {
+			return nil, err
+		}
+
+		if rows >= minRows {
+			warns = append(warns, fmt.Sprintf(
+				"sequential scan on large table: %s (~%.0f rows)", t, rows))
+		}
+	}
+
+	for _, jc := range qp.Joins {
+		var found bool
+
+		// an index can only be used for the join if it
+		// starts with the join column
+		err := db.QueryRowContext(c, `
+			SELECT EXISTS (
+				SELECT 1 FROM pg_index i
+				JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = i.indkey[0]
+				WHERE i.indrelid = to_regclass(format('%I.%I', $1::text, $2::text))
+				AND a.attname = $3)`,
+			jc.Schema, jc.Table, jc.Column).Scan(&found)
+		if err != nil {
+			return nil, err
+		}
+
+		if !found {
+			warns = append(warns, fmt.Sprintf(
+				"missing index on join column: %s.%s.%s", jc.Schema, jc.Table, jc.Column))
+		}
+	}
+
+	return warns, nil
+}
+
+// seqScans returns the tables read using sequential scans in the plan,
+// the schema is only set in the plans of verbose explains
+func seqScans(plan json.RawMessage) ([]scanTable, error) {
+	var ep []explainPlan
+	var tables []scanTable
+
+	if err := json.Unmarshal(plan, &ep); err != nil {
+		return nil, fmt.Errorf("explain: %w", err)
+	}
+
+	seen := make(map[scanTable]struct{})
+
+	var walk func(n planNode)
+	walk = func(n planNode) {
+		if n.NodeType == "Seq Scan" && n.Relation != "" {
+			t := scanTable{Schema: n.Schema, Name: n.Relation}
+
+			if _, ok := seen[t]; !ok {
+				seen[t] = struct{}{}
+				tables = append(tables, t)
+			}
+		}
+		for _, cn := range n.Plans {
+			walk(cn)
+		}
+	}
+
+	for _, p := range ep {
+		walk(p.Plan)
+	}
+
+	return tables, nil
+}
+
+// writeReport prints the report as text with the plan as an indented tree
+func writeReport(w io.Writer, rep explainReport) {
+	name := rep.Name
+	if name == "" {
+		name = "(anonymous)"
+	}
+
+	fmt.Fprintf(w, "Query: %s, Role: %s\n\n", name, rep.Role)
+
+	if rep.SQL != "" {
+		fmt.Fprintf(w, "%s\n\n", rep.SQL)
+	}
+
+	var ep []explainPlan
+
+	if len(rep.Plan) != 0 && json.Unmarshal(rep.Plan, &ep) == nil {
+		for _, p := range ep {
+			writePlanNode(w, p.Plan, 0)
+			// plans of mutations only have the estimates
+			if p.Plan.ActualLoops == 0 {
+				fmt.Fprintf(w, "\nPlanned only, not executed\n\n")
+				continue
+			}
+
+			fmt.Fprintf(w, "\nPlanning: %.3fms, Execution: %.3fms\n\n",
+				p.PlanningTime, p.ExecutionTime)
+		}
+	}
+
+	for _, v := range rep.Warnings {
+		fmt.Fprintf(w, "WARNING: %s\n", v)
+	}
+
+	if rep.Error != "" {
+		fmt.Fprintf(w, "ERROR: %s\n", rep.Error)
+	}
+
+	fmt.Fprintln(w)
+}
+
+func writePlanNode(w io.Writer, n planNode, depth int) {
+	fmt.Fprintf(w, "%s-> %s", strings.Repeat("  ", depth), n.NodeType)
+
+	if n.IndexName != "" {
+		fmt.Fprintf(w, " using %s", n.IndexName)
+	}
+
+	if n.Relation != "" {
+		fmt.Fprintf(w, " on %s", n.Relation)
+
+		if n.Alias != "" && n.Alias != n.Relation {
+			fmt.Fprintf(w, " %s", n.Alias)
+		}
+	}
+
+	if n.ActualLoops == 0 {
+		fmt.Fprintf(w, " (estimated rows=%.0f)\n", n.PlanRows)
+	} else {
+		fmt.Fprintf(w, " (rows=%.0f loops=%.0f time=%.3fms)\n",
+			n.ActualRows, n.ActualLoops, n.ActualTime)
+	}
+
+	for _, cn := range n.Plans {
+		writePlanNode(w, cn, depth+1)
+	}
+}
+
+func apiV1ExplainHandler(servConf *ServConfig) http.Handler {
+	return withAuthAndCORS(servConf, http.HandlerFunc(apiV1Explain(servConf)))
+}
+
+// apiV1Explain is a debug endpoint that returns the explain report for the named
+// query in the request body or for all the queries in the allow list on GET. Only
+// authenticated requests are allowed and the queries are explained for the role
+// of the user making the request.
+func apiV1Explain(servConf *ServConfig) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req gqlReq
+
+		ct := r.Context()
+		w.Header().Set("Content-Type", "application/json")
+
+		if !auth.IsAuth(ct) {
+			renderRestErr(w, http.StatusUnauthorized, errUnauthorized)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			//nolint: errcheck
+			json.NewEncoder(w).Encode(explainAllowList(ct, servConf, "", explainMinRows))
+			return
+		}
+
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxReadBytes))
+		if err != nil {
+			renderErr(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			renderErr(w, err)
+			return
+		}
+
+		// only queries saved to the allow list can be explained
+		_, name := core.Operation(req.Query)
+
+		nq, ok := gj.NamedQuery(name)
+		if !ok {
+			renderRestErr(w, http.StatusNotFound, fmt.Errorf("query not found in allow list: %s", name))
+			return
+		}
+
+		rep := explainQuery(ct, servConf, nq.Query, req.Vars, "", explainMinRows)
+		json.NewEncoder(w).Encode(rep) //nolint: errcheck
+	}
+}
@@ -0,0 +1,116 @@
+package serv
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testPlan = `[{
+  "Plan": {
+    "Node Type": "Aggregate",
+    "Actual Rows": 1, "Actual Loops": 1, "Actual Total Time": 1.5,
+    "Plans": [{
+      "Node Type": "Nested Loop",
+      "Actual Rows": 20, "Actual Loops": 1, "Actual Total Time": 1.2,
+      "Plans": [
+        {"Node Type": "Seq Scan", "Schema": "public", "Relation Name": "products", "Alias": "products_0",
+         "Actual Rows": 20, "Actual Loops": 1, "Actual Total Time": 0.4},
+        {"Node Type": "Index Scan", "Relation Name": "users", "Alias": "users_1",
+         "Index Name": "users_pkey", "Actual Rows": 1, "Actual Loops": 20, "Actual Total Time": 0.01},
+        {"Node Type": "Seq Scan", "Schema": "public", "Relation Name": "products", "Alias": "products_2",
+         "Actual Rows": 3, "Actual Loops": 20, "Actual Total Time": 0.02},
+        {"Node Type": "Seq Scan", "Schema": "archive", "Relation Name": "products", "Alias": "products_3",
+         "Actual Rows": 0, "Actual Loops": 20, "Actual Total Time": 0.01}
+      ]
+    }]
+  },
+  "Planning Time": 0.25,
+  "Execution Time": 1.75
+}]`
+
+func TestSeqScans(t *testing.T) {
+	tables, err := seqScans(json.RawMessage(testPlan))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tables) != 2 || tables[0].String() != "public.products" ||
+		tables[1].String() != "archive.products" {
+		t.Errorf("expected [public.products archive.products] got %v", tables)
+	}
+
+	if _, err := seqScans(json.RawMessage(`{"bad"`)); err == nil {
+		t.Error("expected an error for an invalid plan")
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	var buf bytes.Buffer
+
+	writeReport(&buf, explainReport{
+		Name:     "getProducts",
+		Role:     "user",
+		SQL:      "SELECT 1",
+		Plan:     json.RawMessage(testPlan),
+		Warnings: []string{"missing index on join column: public.products.user_id"},
+	})
+
+	out := buf.String()
+
+	exp := []string{
+		"Query: getProducts, Role: user",
+		"SELECT 1",
+		"-> Aggregate (rows=1 loops=1 time=1.500ms)",
+		"    -> Seq Scan on products products_0 (rows=20 loops=1 time=0.400ms)",
+		"    -> Index Scan using users_pkey on users users_1 (rows=1 loops=20 time=0.010ms)",
+		"Planning: 0.250ms, Execution: 1.750ms",
+		"WARNING: missing index on join column: public.products.user_id",
+	}
+
+	for _, v := range exp {
+		if !strings.Contains(out, v) {
+			t.Errorf("expected report to contain '%s'\n%s", v, out)
+		}
+	}
+}
+
+func TestWriteReportPlanned(t *testing.T) {
+	var buf bytes.Buffer
+
+	plan := `[{"Plan": {"Node Type": "ModifyTable", "Plan Rows": 1,
+		"Plans": [{"Node Type": "Result", "Plan Rows": 1}]}, "Planning Time": 0.1}]`
+
+	writeReport(&buf, explainReport{Name: "createProduct", Role: "user", Plan: json.RawMessage(plan)})
+
+	out := buf.String()
+
+	exp := []string{
+		"-> ModifyTable (estimated rows=1)",
+		"  -> Result (estimated rows=1)",
+		"Planned only, not executed",
+	}
+
+	for _, v := range exp {
+		if !strings.Contains(out, v) {
+			t.Errorf("expected report to contain '%s'\n%s", v, out)
+		}
+	}
+}
+
+func TestExplainEndpointAuth(t *testing.T) {
+	h := apiV1Explain(&ServConfig{conf: &Config{}})
+
+	r := httptest.NewRequest("POST", "/api/v1/explain?role=admin",
+		strings.NewReader(`{"query": "query getProducts { products { id } }"}`))
+	w := httptest.NewRecorder()
+
+	h(w, r)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d got %d", http.StatusUnauthorized, w.Code)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"github.com/dosco/graphjin/core"
 	"github.com/dosco/graphjin/internal/serv/internal/auth"
@@ -37,7 +38,11 @@ type errorResp struct {
 }
 
 func apiV1Handler(servConf *ServConfig) http.Handler {
-	h, err := auth.WithAuth(http.HandlerFunc(apiV1(servConf)), &servConf.conf.Auth)
+	return withAuthAndCORS(servConf, http.HandlerFunc(apiV1(servConf)))
+}
+
+func withAuthAndCORS(servConf *ServConfig, next http.Handler) http.Handler {
+	h, err := withAuth(servConf, next)
 	if err != nil {
 		servConf.log.Fatalf("Error initializing auth: %s", err)
 	}
@@ -54,10 +59,47 @@ func apiV1Handler(servConf *ServConfig) http.Handler {
 	return h
 }
 
+// withAuth wraps the handler with the configured auth, an auth
+// of type chain tries the named auths in the chain in order
+func withAuth(servConf *ServConfig, next http.Handler) (http.Handler, error) {
+	var err error
+	ac := &servConf.conf.Auth
+
+	if ac.Type != "chain" {
+		return auth.WithAuth(next, ac, servConf.db)
+	}
+
+	if len(ac.Chain) == 0 {
+		return nil, errors.New("no auth.chain defined")
+	}
+
+	acs := make([]*auth.Auth, len(ac.Chain))
+
+	for i, name := range ac.Chain {
+		if acs[i] = findAuth(servConf, name); acs[i] == nil {
+			return nil, fmt.Errorf("Invalid auth: %s, For auth chain", name)
+		}
+	}
+
+	if ac.CredsInHeader {
+		if next, err = auth.SimpleHandler(ac, next); err != nil {
+			return nil, err
+		}
+	}
+
+	return auth.ChainHandler(acs, servConf.db, next)
+}
+
 func apiV1(servConf *ServConfig) func(http.ResponseWriter, *http.Request) {
+	// the auth handler for the websocket connection init payload
+	wsAuth, err := withAuth(servConf, http.HandlerFunc(wsAuthDone))
+	if err != nil {
+		servConf.log.Fatalf("Error initializing auth: %s", err)
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		if websocket.IsWebSocketUpgrade(r) {
-			apiV1Ws(servConf, w, r)
+			apiV1Ws(servConf, wsAuth, w, r)
 			return
 		}
 
@@ -84,17 +126,12 @@ func apiV1(servConf *ServConfig) func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
-		rc := core.ReqConfig{Vars: make(map[string]interface{})}
-
-		for k, v := range servConf.conf.HeaderVars {
-			rc.Vars[k] = func() string {
-				if v1, ok := r.Header[v]; ok {
-					return v1[0]
-				}
-				return ""
-			}
+		if op, _ := core.Operation(req.Query); !servConf.limits.allow(w, r, op) {
+			return
 		}
 
+		rc := newReqConfig(servConf, r)
+
 		res, err := gj.GraphQLEx(ct, req.Query, req.Vars, &rc)
 
 		if err == nil {
@@ -119,6 +156,10 @@ func apiV1(servConf *ServConfig) func(http.ResponseWriter, *http.Request) {
 				trace.StringAttribute("role", res.Role()),
 			)
 
+			if v := res.Auth(); v != "" {
+				span.AddAttributes(trace.StringAttribute("auth", v))
+			}
+
 			if err != nil {
 				span.AddAttributes(trace.StringAttribute("error", err.Error()))
 			}
@@ -132,6 +173,33 @@ func apiV1(servConf *ServConfig) func(http.ResponseWriter, *http.Request) {
 	}
 }
 
+// newReqConfig creates the request config with the header variables
+// resolved against the request headers.
+func newReqConfig(servConf *ServConfig, r *http.Request) core.ReqConfig {
+	rc := core.ReqConfig{Vars: make(map[string]interface{})}
+
+	for k, v := range servConf.conf.HeaderVars {
+		v := v
+		rc.Vars[k] = func() string {
+			if v1, ok := r.Header[v]; ok {
+				return v1[0]
+			}
+			return ""
+		}
+	}
+
+	// the active roles picked for the request
+	if v := r.Header.Get("X-Active-Roles"); v != "" {
+		for _, role := range strings.Split(v, ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				rc.Roles = append(rc.Roles, role)
+			}
+		}
+	}
+
+	return rc
+}
+
 func reqLog(servConf *ServConfig, res *core.Result, err error) {
 	fields := []zapcore.Field{
 		zap.String("op", res.OperationName()),
@@ -139,6 +207,10 @@ func reqLog(servConf *ServConfig, res *core.Result, err error) {
 		zap.String("role", res.Role()),
 	}
 
+	if v := res.Auth(); v != "" {
+		fields = append(fields, zap.String("auth", v))
+	}
+
 	if servConf.logLevel >= LogLevelDebug {
 		fields = append(fields, zap.String("sql", res.SQL()))
 	}
@@ -83,6 +83,16 @@ func initConf(servConfig *ServConfig) (*Config, error) {
 		axm[a.Name] = struct{}{}
 	}
 
+	// Jobs: validate and sanitize
+	if err := initJobs(c); err != nil {
+		return nil, err
+	}
+
+	// Event triggers: validate and sanitize
+	if err := initEventTriggers(c); err != nil {
+		return nil, err
+	}
+
 	var anonFound bool
 
 	for _, r := range c.Roles {
@@ -293,3 +303,71 @@ func initTelemetry(servConfig *ServConfig, db *sql.DB, driverName string) (strin
 	servConfig.log.Info("OpenCensus telemetry enabled")
 	return driverName, nil
 }
+
+// initTLS returns the tls config for the server, nil when no
+// certificate is set. Certificates can be files or PEM values.
+func initTLS(c *Config) (*tls.Config, error) {
+	tc := c.TLS
+
+	if tc.Cert == "" {
+		if tc.ClientCA != "" {
+			return nil, errors.New("tls: client_ca needs a cert and key")
+		}
+		return nil, nil
+	}
+
+	if tc.Key == "" {
+		return nil, errors.New("tls: key is required")
+	}
+
+	var cert tls.Certificate
+	var err error
+
+	if strings.Contains(tc.Cert, pemSig) {
+		cert, err = tls.X509KeyPair([]byte(tc.Cert), []byte(tc.Key))
+	} else {
+		cert, err = tls.LoadX509KeyPair(c.relPath(tc.Cert), c.relPath(tc.Key))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+
+	conf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if tc.ClientCA == "" {
+		return conf, nil
+	}
+
+	var pem []byte
+
+	if strings.Contains(tc.ClientCA, pemSig) {
+		pem = []byte(tc.ClientCA)
+	} else {
+		pem, err = ioutil.ReadFile(c.relPath(tc.ClientCA))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+
+	conf.ClientCAs = x509.NewCertPool()
+
+	if ok := conf.ClientCAs.AppendCertsFromPEM(pem); !ok {
+		return nil, errors.New("tls: failed to append client_ca pem")
+	}
+
+	switch tc.ClientAuth {
+	case "", "verify_if_given":
+		conf.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("tls: invalid client_auth: %s", tc.ClientAuth)
+	}
+
+	return conf, nil
+}
@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	apiKeyPrefix   = "gj_"
+	apiKeyCacheTTL = 30 * time.Second
+)
+
+var apiKeyIdentRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+type apiKeyCtxKey struct{}
+
+// APIKeyHash returns the hash of the api key used to authenticate the request
+func APIKeyHash(c context.Context) (string, bool) {
+	v, ok := c.Value(apiKeyCtxKey{}).(string)
+	return v, ok
+}
+
+// APIKeyHandler looks up the SHA256 hash of the api key from the header or query
+// param in the api keys table and sets the user and role of the key. Unknown,
+// expired and revoked keys make the request anonymous.
+func APIKeyHandler(ac *Auth, db *sql.DB, next http.Handler) (http.HandlerFunc, error) {
+	if db == nil {
+		return nil, fmt.Errorf("auth '%s': api_key auth needs a database", ac.Name)
+	}
+
+	if err := initAPIKey(ac); err != nil {
+		return nil, err
+	}
+
+	ak := ac.APIKey
+	cache := newSessionCache(ak.CacheTTL)
+
+	q := fmt.Sprintf(`SELECT %s, %s FROM %s WHERE %s = $1 AND %s IS NOT TRUE AND (%s IS NULL OR %s > now())`,
+		ak.UserIDColumn, ak.RoleColumn, ak.Table,
+		ak.HashColumn, ak.RevokedColumn, ak.ExpiresColumn, ak.ExpiresColumn)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(ak.Header)
+
+		if key == "" && ak.Param != "" {
+			key = r.URL.Query().Get(ak.Param)
+		}
+		key = strings.TrimPrefix(key, "Bearer ")
+
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		hash := hashKey(key)
+		sess, ok := cache.get(hash)
+
+		if !ok {
+			var userID, role sql.NullString
+
+			err := db.QueryRowContext(r.Context(), q, hash).Scan(&userID, &role)
+
+			switch {
+			case err == sql.ErrNoRows:
+				sess = nil
+
+			case err != nil:
+				http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+				return
+
+			default:
+				sess = &session{UserID: userID.String, Role: role.String}
+			}
+
+			cache.set(hash, sess)
+		}
+
+		if sess == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(sess.withContext(r.Context()), apiKeyCtxKey{}, hash)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}, nil
+}
+
+// CreateAPIKey saves the hash of a new api key for the user and returns the key,
+// the key itself is not stored. A zero expires time creates a key that does not expire.
+func CreateAPIKey(db *sql.DB, ac *Auth, userID, role string, expires time.Time) (string, error) {
+	if err := initAPIKey(ac); err != nil {
+		return "", err
+	}
+	ak := ac.APIKey
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	var exp sql.NullTime
+	if !expires.IsZero() {
+		exp = sql.NullTime{Time: expires, Valid: true}
+	}
+
+	var r sql.NullString
+	if role != "" {
+		r = sql.NullString{String: role, Valid: true}
+	}
+
+	_, err := db.Exec(fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s) VALUES ($1, $2, $3, $4)`,
+		ak.Table, ak.HashColumn, ak.UserIDColumn, ak.RoleColumn, ak.ExpiresColumn),
+		hashKey(key), userID, r, exp)
+
+	if err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+// RevokeAPIKey revokes the api key, the key can also be given as its hash
+func RevokeAPIKey(db *sql.DB, ac *Auth, key string) error {
+	if err := initAPIKey(ac); err != nil {
+		return err
+	}
+	ak := ac.APIKey
+
+	hash := key
+	if strings.HasPrefix(key, apiKeyPrefix) {
+		hash = hashKey(key)
+	}
+
+	res, err := db.Exec(fmt.Sprintf(`UPDATE %s SET %s = true WHERE %s = $1`,
+		ak.Table, ak.RevokedColumn, ak.HashColumn), hash)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errors.New("api key not found")
+	}
+	return nil
+}
+
+// initAPIKey sets the defaults for the api key config
+// and checks the table and column names
+func initAPIKey(ac *Auth) error {
+	ak := &ac.APIKey
+
+	defaults := []struct {
+		v   *string
+		def string
+	}{
+		{&ak.Header, "X-API-Key"},
+		{&ak.Table, "api_keys"},
+		{&ak.HashColumn, "key_hash"},
+		{&ak.UserIDColumn, "user_id"},
+		{&ak.RoleColumn, "role"},
+		{&ak.ExpiresColumn, "expires_at"},
+		{&ak.RevokedColumn, "revoked"},
+	}
+
+	for _, d := range defaults {
+		if *d.v == "" {
+			*d.v = d.def
+		}
+	}
+
+	if ak.CacheTTL == 0 {
+		ak.CacheTTL = apiKeyCacheTTL
+	}
+
+	for _, v := range []string{ak.Table, ak.HashColumn, ak.UserIDColumn,
+		ak.RoleColumn, ak.ExpiresColumn, ak.RevokedColumn} {
+		if !apiKeyIdentRe.MatchString(v) {
+			return fmt.Errorf("auth '%s': invalid api_key table or column: %s", ac.Name, v)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,21 @@
+package auth
+
+import "testing"
+
+func TestInitAPIKey(t *testing.T) {
+	ac := &Auth{Name: "test", Type: "api_key"}
+
+	if err := initAPIKey(ac); err != nil {
+		t.Fatal(err)
+	}
+
+	if ac.APIKey.Header != "X-API-Key" || ac.APIKey.Table != "api_keys" {
+		t.Errorf("expected default header and table got %s %s", ac.APIKey.Header, ac.APIKey.Table)
+	}
+
+	ac.APIKey.RoleColumn = "role; DROP TABLE users"
+
+	if err := initAPIKey(ac); err == nil {
+		t.Error("expected an error for an invalid column name")
+	}
+}
@@ -2,8 +2,10 @@ package auth
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/dosco/graphjin/core"
 )
@@ -15,6 +17,9 @@ type Auth struct {
 	Cookie        string
 	CredsInHeader bool `mapstructure:"creds_in_header"`
 
+	// Chain is the ordered list of named auths tried by an auth of type chain
+	Chain []string
+
 	Rails struct {
 		Version       string
 		SecretKeyBase string `mapstructure:"secret_key_base"`
@@ -33,6 +38,14 @@ type Auth struct {
 		PubKeyFile string `mapstructure:"public_key_file"`
 		PubKeyType string `mapstructure:"public_key_type"`
 		Audience   string `mapstructure:"audience"`
+		RoleClaim  string `mapstructure:"role_claim"`
+
+		// JWKSURL is the endpoint to fetch the signing keys from, when
+		// only the Issuer is set the endpoint is discovered from it
+		JWKSURL     string        `mapstructure:"jwks_url"`
+		JWKSRefresh time.Duration `mapstructure:"jwks_refresh"`
+		Issuer      string
+		Leeway      time.Duration
 	}
 
 	Header struct {
@@ -40,6 +53,41 @@ type Auth struct {
 		Value  string
 		Exists bool
 	}
+
+	Webhook struct {
+		URL    string
+		Method string
+
+		// Headers and Cookies are the request headers and
+		// cookies forwarded to the webhook
+		Headers []string
+		Cookies []string
+
+		Timeout  time.Duration
+		CacheTTL time.Duration `mapstructure:"cache_ttl"`
+
+		// FailOpen continues as an anonymous request when the
+		// webhook fails instead of rejecting the request
+		FailOpen bool `mapstructure:"fail_open"`
+	}
+
+	APIKey struct {
+		Header        string
+		Param         string
+		Table         string
+		HashColumn    string        `mapstructure:"hash_column"`
+		UserIDColumn  string        `mapstructure:"user_id_column"`
+		RoleColumn    string        `mapstructure:"role_column"`
+		ExpiresColumn string        `mapstructure:"expires_column"`
+		RevokedColumn string        `mapstructure:"revoked_column"`
+		CacheTTL      time.Duration `mapstructure:"cache_ttl"`
+	} `mapstructure:"api_key"`
+
+	MTLS struct {
+		// Rules map the client certificate to the user, the first
+		// rule that matches the certificate is used
+		Rules []MTLSRule
+	} `mapstructure:"mtls"`
 }
 
 func SimpleHandler(ac *Auth, next http.Handler) (http.HandlerFunc, error) {
@@ -97,7 +145,9 @@ func HeaderHandler(ac *Auth, next http.Handler) (http.HandlerFunc, error) {
 	}, nil
 }
 
-func WithAuth(next http.Handler, ac *Auth) (http.Handler, error) {
+// WithAuth wraps the handler with the auth handler for the auth type, the
+// database is only needed for api key auth
+func WithAuth(next http.Handler, ac *Auth, db *sql.DB) (http.Handler, error) {
 	var err error
 
 	if ac.CredsInHeader {
@@ -118,6 +168,15 @@ func WithAuth(next http.Handler, ac *Auth) (http.Handler, error) {
 	case "header":
 		return HeaderHandler(ac, next)
 
+	case "webhook":
+		return WebhookHandler(ac, next)
+
+	case "api_key":
+		return APIKeyHandler(ac, db, next)
+
+	case "mtls":
+		return MTLSHandler(ac, next)
+
 	}
 
 	return next, nil
@@ -126,3 +185,87 @@ func WithAuth(next http.Handler, ac *Auth) (http.Handler, error) {
 func IsAuth(ct context.Context) bool {
 	return ct.Value(core.UserIDKey) != nil
 }
+
+type chainCtxKey struct{}
+
+// ChainHandler tries the auths in order, the first one that sets a user is used
+// and its name is set on the context. An auth that rejects the request, like a
+// header auth with a missing header or a webhook that fails closed, ends the
+// chain with its response. Requests that no auth sets a user for continue as
+// anonymous requests.
+func ChainHandler(acs []*Auth, db *sql.DB, next http.Handler) (http.HandlerFunc, error) {
+	handlers := make([]http.Handler, len(acs))
+
+	// saves the context set by the auth handler
+	done := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v, ok := r.Context().Value(chainCtxKey{}).(*context.Context); ok {
+			*v = r.Context()
+		}
+	})
+
+	for i, ac := range acs {
+		h, err := WithAuth(done, ac, db)
+		if err != nil {
+			return nil, err
+		}
+		handlers[i] = h
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		for i, h := range handlers {
+			var ctx context.Context
+			cw := &chainWriter{}
+
+			r1 := r.WithContext(context.WithValue(r.Context(), chainCtxKey{}, &ctx))
+			h.ServeHTTP(cw, r1)
+
+			// the auth rejected the request
+			if ctx == nil && cw.code != 0 {
+				http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if ctx == nil || !IsAuth(ctx) {
+				continue
+			}
+
+			name := acs[i].Name
+			if name == "" {
+				name = acs[i].Type
+			}
+			ctx = context.WithValue(ctx, core.UserAuthKey, name)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}, nil
+}
+
+// chainWriter drops the responses of the auths tried by
+// the chain and keeps the status code they set
+type chainWriter struct {
+	h    http.Header
+	code int
+}
+
+func (w *chainWriter) Header() http.Header {
+	if w.h == nil {
+		w.h = make(http.Header)
+	}
+	return w.h
+}
+
+func (w *chainWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (w *chainWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/dosco/graphjin/core"
+)
+
+func TestChainHandler(t *testing.T) {
+	a1 := &Auth{Name: "hdr", Type: "header"}
+	a1.Header.Name = "X-Secret"
+	a1.Header.Value = "secret"
+
+	a2 := &Auth{Name: "first", Type: "jwt"}
+	a2.JWT.Secret = "secret1"
+
+	a3 := &Auth{Name: "second", Type: "jwt"}
+	a3.JWT.Secret = "secret2"
+
+	var userID, authName interface{}
+
+	h, err := ChainHandler([]*Auth{a1, a2, a3}, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID = r.Context().Value(core.UserIDKey)
+		authName = r.Context().Value(core.UserAuthKey)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1"}).
+		SignedString([]byte("secret2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+tok)
+	req.Header.Set("X-Secret", "secret")
+	w := httptest.NewRecorder()
+	h(w, req)
+
+	if w.Code != 200 || userID != "1" || authName != "second" {
+		t.Errorf("expected user 1 from auth 'second' got %d %v %v", w.Code, userID, authName)
+	}
+
+	// the header auth rejects requests without the secret
+	userID, authName = nil, nil
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+tok)
+	w = httptest.NewRecorder()
+	h(w, req)
+
+	if w.Code != 401 || userID != nil {
+		t.Errorf("expected the request to be rejected got %d %v", w.Code, userID)
+	}
+
+	userID, authName = nil, nil
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Secret", "secret")
+	w = httptest.NewRecorder()
+	h(w, req)
+
+	if w.Code != 200 || userID != nil || authName != nil {
+		t.Errorf("expected an anonymous request got %d %v %v", w.Code, userID, authName)
+	}
+}
+
+func TestChainHandlerWebhook(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	a1 := &Auth{Name: "session", Type: "webhook"}
+	a1.Webhook.URL = ts.URL
+	a1.Webhook.Headers = []string{"Cookie"}
+
+	a2 := &Auth{Name: "bearer", Type: "jwt"}
+	a2.JWT.Secret = "secret"
+
+	var called bool
+
+	h, err := ChainHandler([]*Auth{a1, a2}, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Cookie", "session=1")
+	w := httptest.NewRecorder()
+	h(w, req)
+
+	if w.Code != 401 || called {
+		t.Errorf("expected the failed webhook to reject the request got %d", w.Code)
+	}
+
+	// a webhook that fails open continues the chain
+	a1.Webhook.FailOpen = true
+
+	if h, err = ChainHandler([]*Auth{a1, a2}, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	w = httptest.NewRecorder()
+	h(w, req)
+
+	if w.Code != 200 || !called {
+		t.Errorf("expected an anonymous request got %d", w.Code)
+	}
+}
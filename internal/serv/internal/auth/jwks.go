@@ -0,0 +1,316 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	jwksRefresh = time.Hour
+
+	// minimum time between fetches triggered by unknown key ids
+	jwksMinRefresh = time.Minute
+
+	// wait after a failed fetch, it doubles with each failure
+	jwksRetryBackoff    = 5 * time.Second
+	jwksMaxRetryBackoff = 5 * time.Minute
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwksKey struct {
+	alg string
+	key interface{}
+}
+
+// jwksCache holds the signing keys fetched from a JWKS endpoint, the
+// endpoint is discovered from the issuer when no url is configured
+type jwksCache struct {
+	url     string
+	issuer  string
+	refresh time.Duration
+	client  *http.Client
+
+	lock      sync.RWMutex
+	fetchLock sync.Mutex
+	keys      map[string]jwksKey
+	fetched   time.Time
+
+	// the last failed fetch, fetches are skipped till the
+	// backoff for the number of failures has passed
+	failed   time.Time
+	failures int
+	err      error
+}
+
+func newJWKSCache(url, issuer string, refresh time.Duration) *jwksCache {
+	if refresh == 0 {
+		refresh = jwksRefresh
+	}
+
+	return &jwksCache{
+		url:     url,
+		issuer:  issuer,
+		refresh: refresh,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// run fetches the keys and refreshes them periodically, it
+// runs for as long as the service that uses the keys
+func (j *jwksCache) run() {
+	//nolint: errcheck
+	j.fetchAfter(time.Now())
+
+	t := time.NewTicker(j.refresh)
+	defer t.Stop()
+
+	for range t.C {
+		//nolint: errcheck
+		j.fetchAfter(time.Now())
+	}
+}
+
+// keyFunc returns the key for the kid in the token header. The keys are refreshed
+// in the background by run and an unknown kid fetches the keys again.
+func (j *jwksCache) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	j.lock.RLock()
+	k, ok := j.findKey(kid)
+	fetched := j.fetched
+	j.lock.RUnlock()
+
+	if !ok && time.Since(fetched) > jwksMinRefresh {
+		if err := j.fetchAfter(fetched); err != nil {
+			return nil, err
+		}
+		j.lock.RLock()
+		k, ok = j.findKey(kid)
+		j.lock.RUnlock()
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("jwks: no key found for kid '%s'", kid)
+	}
+
+	if k.alg != "" && k.alg != token.Method.Alg() {
+		return nil, fmt.Errorf("jwks: key '%s' is not for alg '%s'", kid, token.Method.Alg())
+	}
+
+	return k.key, nil
+}
+
+// findKey must be called with the lock held, tokens without
+// a kid can only be used when there is a single key
+func (j *jwksCache) findKey(kid string) (jwksKey, bool) {
+	if kid == "" && len(j.keys) == 1 {
+		for _, k := range j.keys {
+			return k, true
+		}
+	}
+	k, ok := j.keys[kid]
+	return k, ok
+}
+
+// fetchAfter fetches the keys unless another request already fetched them
+// after the given time. After a failed fetch the error is returned without
+// fetching again till the backoff has passed so an outage of the identity
+// provider does not slow down every request.
+func (j *jwksCache) fetchAfter(t time.Time) error {
+	j.fetchLock.Lock()
+	defer j.fetchLock.Unlock()
+
+	j.lock.RLock()
+	fetched := j.fetched
+	j.lock.RUnlock()
+
+	if fetched.After(t) {
+		return nil
+	}
+
+	if j.failures != 0 && time.Since(j.failed) < jwksBackoff(j.failures) {
+		return j.err
+	}
+
+	if err := j.fetch(); err != nil {
+		j.failed = time.Now()
+		j.failures++
+		j.err = err
+		return err
+	}
+
+	j.failures = 0
+	return nil
+}
+
+// jwksBackoff doubles the wait after each failed fetch
+func jwksBackoff(failures int) time.Duration {
+	d := jwksRetryBackoff
+	for i := 1; i < failures && d < jwksMaxRetryBackoff; i++ {
+		d *= 2
+	}
+
+	if d > jwksMaxRetryBackoff {
+		d = jwksMaxRetryBackoff
+	}
+	return d
+}
+
+func (j *jwksCache) fetch() error {
+	var ks struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	url, err := j.jwksURL()
+	if err != nil {
+		return err
+	}
+
+	if err := j.getJSON(url, &ks); err != nil {
+		return fmt.Errorf("jwks: %w", err)
+	}
+
+	keys := make(map[string]jwksKey, len(ks.Keys))
+
+	for _, v := range ks.Keys {
+		if v.Use != "" && v.Use != "sig" {
+			continue
+		}
+
+		key, err := parseJWK(v)
+		if err != nil {
+			return fmt.Errorf("jwks: key '%s': %w", v.Kid, err)
+		}
+
+		if key != nil {
+			keys[v.Kid] = jwksKey{alg: v.Alg, key: key}
+		}
+	}
+
+	j.lock.Lock()
+	j.keys = keys
+	j.fetched = time.Now()
+	j.lock.Unlock()
+
+	return nil
+}
+
+// jwksURL returns the configured url or the one
+// from the issuers openid configuration
+func (j *jwksCache) jwksURL() (string, error) {
+	j.lock.RLock()
+	url := j.url
+	j.lock.RUnlock()
+
+	if url != "" {
+		return url, nil
+	}
+
+	var oc struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+
+	ocURL := strings.TrimSuffix(j.issuer, "/") + "/.well-known/openid-configuration"
+
+	if err := j.getJSON(ocURL, &oc); err != nil {
+		return "", fmt.Errorf("openid discovery: %w", err)
+	}
+
+	if oc.JWKSURI == "" {
+		return "", errors.New("openid discovery: no jwks_uri found")
+	}
+
+	j.lock.Lock()
+	j.url = oc.JWKSURI
+	j.lock.Unlock()
+
+	return oc.JWKSURI, nil
+}
+
+func (j *jwksCache) getJSON(url string, v interface{}) error {
+	resp, err := j.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// parseJWK returns the public key for RSA and EC keys,
+// other key types are ignored
+func parseJWK(k jwk) (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func TestJWKSFetchBackoff(t *testing.T) {
+	var hits, down int32 = 0, 1
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"keys": []}`)) //nolint: errcheck
+	}))
+	defer ts.Close()
+
+	j := newJWKSCache(ts.URL, "", 0)
+	token := &jwt.Token{Header: map[string]interface{}{"kid": "k1"}}
+
+	for i := 0; i < 3; i++ {
+		if _, err := j.keyFunc(token); err == nil {
+			t.Fatal("expected an error while the endpoint is down")
+		}
+	}
+
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("expected a single fetch while backing off got %d", n)
+	}
+
+	// the endpoint is fetched again once the backoff has passed
+	atomic.StoreInt32(&down, 0)
+	j.failed = time.Now().Add(-jwksRetryBackoff)
+
+	if _, err := j.keyFunc(token); err == nil {
+		t.Error("expected an error for the unknown kid")
+	}
+
+	if n := atomic.LoadInt32(&hits); n != 2 || j.failures != 0 {
+		t.Errorf("expected a successful fetch got %d fetches and %d failures", n, j.failures)
+	}
+}
+
+func TestJWKSBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		exp      time.Duration
+	}{
+		{1, 5 * time.Second},
+		{2, 10 * time.Second},
+		{4, 40 * time.Second},
+		{20, jwksMaxRetryBackoff},
+	}
+
+	for _, v := range tests {
+		if d := jwksBackoff(v.failures); d != v.exp {
+			t.Errorf("failures %d: expected %s got %s", v.failures, v.exp, d)
+		}
+	}
+}
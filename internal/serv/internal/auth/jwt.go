@@ -47,7 +47,17 @@ func JwtHandler(ac *Auth, next http.Handler) (http.HandlerFunc, error) {
 	secret := ac.JWT.Secret
 	publicKeyFile := ac.JWT.PubKeyFile
 
+	var keyFunc jwt.Keyfunc
+
 	switch {
+	case jwtProvider == jwtFirebase:
+		keyFunc = firebaseKeyFunction
+
+	case ac.JWT.JWKSURL != "" || (ac.JWT.Issuer != "" && secret == "" && publicKeyFile == ""):
+		jc := newJWKSCache(ac.JWT.JWKSURL, ac.JWT.Issuer, ac.JWT.JWKSRefresh)
+		go jc.run()
+		keyFunc = jc.keyFunc
+
 	case secret != "":
 		key = []byte(secret)
 
@@ -74,6 +84,16 @@ func JwtHandler(ac *Auth, next http.Handler) (http.HandlerFunc, error) {
 		}
 	}
 
+	if keyFunc == nil {
+		keyFunc = func(token *jwt.Token) (interface{}, error) {
+			return key, nil
+		}
+	}
+
+	// json numbers keep large integer claims intact, the claims
+	// are validated below to allow for clock skew
+	parser := &jwt.Parser{UseJSONNumber: true, SkipClaimsValidation: true}
+
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		var tok string
@@ -94,41 +114,43 @@ func JwtHandler(ac *Auth, next http.Handler) (http.HandlerFunc, error) {
 			tok = ah[7:]
 		}
 
-		var keyFunc jwt.Keyfunc
-		if jwtProvider == jwtFirebase {
-			keyFunc = firebaseKeyFunction
-		} else {
-			keyFunc = func(token *jwt.Token) (interface{}, error) {
-				return key, nil
-			}
-		}
-
-		token, err := jwt.ParseWithClaims(tok, &jwt.StandardClaims{}, keyFunc)
+		token, err := parser.Parse(tok, keyFunc)
 
 		if err != nil {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		if claims, ok := token.Claims.(*jwt.StandardClaims); ok {
+		if claims, ok := token.Claims.(jwt.MapClaims); ok {
 			ctx := r.Context()
 
-			if ac.JWT.Audience != "" && claims.Audience != ac.JWT.Audience {
+			if !validClaims(claims, ac, time.Now()) {
 				next.ServeHTTP(w, r)
 				return
 			}
 
+			subject, _ := claims["sub"].(string)
+			issuer, _ := claims["iss"].(string)
+
 			if jwtProvider == jwtAuth0 {
-				sub := strings.Split(claims.Subject, "|")
-				if len(sub) != 2 {
+				sub := strings.Split(subject, "|")
+				if len(sub) == 2 {
 					ctx = context.WithValue(ctx, core.UserIDProviderKey, sub[0])
 					ctx = context.WithValue(ctx, core.UserIDKey, sub[1])
 				}
 			} else if jwtProvider == jwtFirebase &&
-				claims.Issuer == firebaseIssuerPrefix+ac.JWT.Audience {
-				ctx = context.WithValue(ctx, core.UserIDKey, claims.Subject)
+				issuer == firebaseIssuerPrefix+ac.JWT.Audience {
+				ctx = context.WithValue(ctx, core.UserIDKey, subject)
 			} else {
-				ctx = context.WithValue(ctx, core.UserIDKey, claims.Subject)
+				ctx = context.WithValue(ctx, core.UserIDKey, subject)
+			}
+
+			ctx = context.WithValue(ctx, core.UserClaimsKey, map[string]interface{}(claims))
+
+			if ac.JWT.RoleClaim != "" {
+				if role := claimRole(claimValue(claims, ac.JWT.RoleClaim)); role != "" {
+					ctx = context.WithValue(ctx, core.UserRoleKey, role)
+				}
 			}
 
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -139,6 +161,102 @@ func JwtHandler(ac *Auth, next http.Handler) (http.HandlerFunc, error) {
 	}, nil
 }
 
+// validClaims checks the expiry, not before and issued at times allowing
+// for the configured leeway and the issuer and audience when set
+func validClaims(claims jwt.MapClaims, ac *Auth, now time.Time) bool {
+	leeway := int64(ac.JWT.Leeway / time.Second)
+	ts := now.Unix()
+
+	if v, ok := timeClaim(claims, "exp"); ok && ts > v+leeway {
+		return false
+	}
+
+	if v, ok := timeClaim(claims, "nbf"); ok && ts < v-leeway {
+		return false
+	}
+
+	if v, ok := timeClaim(claims, "iat"); ok && ts < v-leeway {
+		return false
+	}
+
+	if ac.JWT.Issuer != "" {
+		if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != strings.TrimSuffix(ac.JWT.Issuer, "/") {
+			return false
+		}
+	}
+
+	if ac.JWT.Audience != "" && !hasAudience(claims, ac.JWT.Audience) {
+		return false
+	}
+
+	return true
+}
+
+func timeClaim(claims jwt.MapClaims, name string) (int64, bool) {
+	switch v := claims[name].(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, true
+		}
+		if f, err := v.Float64(); err == nil {
+			return int64(f), true
+		}
+	case float64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// hasAudience returns true if the aud claim is the audience or
+// is a list that contains it
+func hasAudience(claims jwt.MapClaims, aud string) bool {
+	switch v := claims["aud"].(type) {
+	case string:
+		return v == aud
+
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == aud {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// claimRole returns the role from the role claim, a list
+// of roles is returned as a comma separated list
+func claimRole(v interface{}) string {
+	switch v1 := v.(type) {
+	case string:
+		return v1
+	case []interface{}:
+		var roles []string
+		for _, r := range v1 {
+			if r1, ok := r.(string); ok && r1 != "" {
+				roles = append(roles, r1)
+			}
+		}
+		return strings.Join(roles, ",")
+	}
+	return ""
+}
+
+// claimValue returns the value at a dot separated
+// path in the claims. Eg. app_metadata.role
+func claimValue(claims map[string]interface{}, path string) interface{} {
+	var v interface{} = claims
+
+	for _, k := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
+
 type firebaseKeyError struct {
 	Err     error
 	Message string
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/dosco/graphjin/core"
+)
+
+func TestJwtHandlerClaims(t *testing.T) {
+	ac := &Auth{Type: "jwt"}
+	ac.JWT.Secret = "secret"
+	ac.JWT.Audience = "graphjin"
+	ac.JWT.RoleClaim = "app_metadata.role"
+
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":          "1",
+		"aud":          []string{"other", "graphjin"},
+		"org_id":       12345678901,
+		"app_metadata": map[string]interface{}{"role": "admin"},
+	}).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims map[string]interface{}
+	var role interface{}
+
+	h, err := JwtHandler(ac, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ = r.Context().Value(core.UserClaimsKey).(map[string]interface{})
+		role = r.Context().Value(core.UserRoleKey)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+tok)
+	h(httptest.NewRecorder(), req)
+
+	if claims == nil {
+		t.Fatal("expected claims on the context")
+	}
+
+	if v := claims["org_id"]; v == nil || v.(interface{ String() string }).String() != "12345678901" {
+		t.Errorf("expected claim org_id to be 12345678901 got %v", v)
+	}
+
+	if role != "admin" {
+		t.Errorf("expected role 'admin' got %v", role)
+	}
+}
+
+func TestJwtHandlerAuth0(t *testing.T) {
+	ac := &Auth{Type: "jwt"}
+	ac.JWT.Provider = "auth0"
+	ac.JWT.Secret = "secret"
+
+	var userID, provider interface{}
+
+	h, err := JwtHandler(ac, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID = r.Context().Value(core.UserIDKey)
+		provider = r.Context().Value(core.UserIDProviderKey)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := func(sub string) {
+		userID, provider = nil, nil
+
+		tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": sub}).
+			SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+tok)
+		h(httptest.NewRecorder(), r)
+	}
+
+	req("google-oauth2|42")
+
+	if userID != "42" || provider != "google-oauth2" {
+		t.Errorf("expected user 42 from google-oauth2 got %v from %v", userID, provider)
+	}
+
+	// subjects without a provider are not valid auth0 subjects
+	req("42")
+
+	if userID != nil {
+		t.Errorf("expected no user got %v", userID)
+	}
+}
+
+func TestJwtHandlerJWKS(t *testing.T) {
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var issuer string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := base64.RawURLEncoding
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]string{"jwks_uri": issuer + "/keys"})
+		case "/keys":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+				"kty": "RSA", "kid": "k1", "alg": "RS256", "use": "sig",
+				"n": enc.EncodeToString(pk.N.Bytes()),
+				"e": enc.EncodeToString(big.NewInt(int64(pk.E)).Bytes()),
+			}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	issuer = ts.URL
+
+	ac := &Auth{Type: "jwt"}
+	ac.JWT.Issuer = issuer
+	ac.JWT.Leeway = time.Minute
+
+	var userID interface{}
+
+	h, err := JwtHandler(ac, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID = r.Context().Value(core.UserIDKey)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		kid    string
+		claims jwt.MapClaims
+		valid  bool
+	}{
+		{"valid", "k1", jwt.MapClaims{"sub": "1", "iss": issuer}, true},
+		{"expired within leeway", "k1", jwt.MapClaims{"sub": "1", "iss": issuer,
+			"exp": time.Now().Add(-30 * time.Second).Unix()}, true},
+		{"expired", "k1", jwt.MapClaims{"sub": "1", "iss": issuer,
+			"exp": time.Now().Add(-2 * time.Minute).Unix()}, false},
+		{"not before", "k1", jwt.MapClaims{"sub": "1", "iss": issuer,
+			"nbf": time.Now().Add(2 * time.Minute).Unix()}, false},
+		{"wrong issuer", "k1", jwt.MapClaims{"sub": "1", "iss": "https://example.com"}, false},
+		{"unknown kid", "k2", jwt.MapClaims{"sub": "1", "iss": issuer}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, tt.claims)
+			token.Header["kid"] = tt.kid
+
+			tok, err := token.SignedString(pk)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			userID = nil
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tok)
+			h(httptest.NewRecorder(), req)
+
+			if (userID != nil) != tt.valid {
+				t.Errorf("expected valid %t got user id %v", tt.valid, userID)
+			}
+		})
+	}
+}
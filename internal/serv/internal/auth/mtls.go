@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// MTLSRule maps a client certificate field to a user
+type MTLSRule struct {
+	// Field is the certificate field matched: cn, dns, email,
+	// uri, ou or o. Defaults to cn
+	Field string
+
+	// Match is a regular expression the field must match,
+	// defaults to matching any value
+	Match string
+
+	// UserID is the user id, it can use the groups captured by
+	// match eg. $1. Defaults to the field value
+	UserID string `mapstructure:"user_id"`
+
+	// Role is the role of the user, it can also use the groups captured by match
+	Role string
+
+	re *regexp.Regexp
+}
+
+// MTLSHandler sets the user from the verified client certificate using the first
+// rule that matches it. The fields of the certificate are set as claims so they can
+// be used as $jwt.cn, $jwt.dns, etc. Requests without a verified certificate or
+// that no rule matches are anonymous.
+func MTLSHandler(ac *Auth, next http.Handler) (http.HandlerFunc, error) {
+	rules := ac.MTLS.Rules
+
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("auth '%s': no mtls.rules defined", ac.Name)
+	}
+
+	for i := range rules {
+		r := &rules[i]
+
+		if r.Field == "" {
+			r.Field = "cn"
+		}
+
+		if _, ok := certFields(&x509.Certificate{})[r.Field]; !ok {
+			return nil, fmt.Errorf("auth '%s': invalid mtls field: %s", ac.Name, r.Field)
+		}
+
+		if r.UserID == "" {
+			r.UserID = "$0"
+		}
+
+		match := r.Match
+		if match == "" {
+			match = ".*"
+		}
+
+		var err error
+		if r.re, err = regexp.Compile("^(?:" + match + ")$"); err != nil {
+			return nil, fmt.Errorf("auth '%s': invalid mtls match: %w", ac.Name, err)
+		}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// only certificates verified against the client ca are used
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sess := certSession(r.TLS.VerifiedChains[0][0], rules)
+		if sess == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(sess.withContext(r.Context())))
+	}, nil
+}
+
+// certSession returns the session for the first rule that matches
+// a value of its field, nil is returned when no rule matches
+func certSession(cert *x509.Certificate, rules []MTLSRule) *session {
+	fields := certFields(cert)
+
+	for _, rule := range rules {
+		for _, v := range fields[rule.Field] {
+			m := rule.re.FindStringSubmatchIndex(v)
+			if m == nil {
+				continue
+			}
+
+			userID := string(rule.re.ExpandString(nil, rule.UserID, v, m))
+			if userID == "" {
+				continue
+			}
+
+			return &session{
+				UserID:         userID,
+				UserIDProvider: "mtls",
+				Role:           string(rule.re.ExpandString(nil, rule.Role, v, m)),
+				Claims:         certClaims(cert, fields),
+			}
+		}
+	}
+
+	return nil
+}
+
+func certFields(cert *x509.Certificate) map[string][]string {
+	var uris []string
+
+	for _, u := range cert.URIs {
+		uris = append(uris, u.String())
+	}
+
+	var cn []string
+	if cert.Subject.CommonName != "" {
+		cn = []string{cert.Subject.CommonName}
+	}
+
+	return map[string][]string{
+		"cn":    cn,
+		"dns":   cert.DNSNames,
+		"email": cert.EmailAddresses,
+		"uri":   uris,
+		"ou":    cert.Subject.OrganizationalUnit,
+		"o":     cert.Subject.Organization,
+	}
+}
+
+func certClaims(cert *x509.Certificate, fields map[string][]string) map[string]interface{} {
+	claims := map[string]interface{}{
+		"cn":        cert.Subject.CommonName,
+		"serial":    cert.SerialNumber.String(),
+		"issuer_cn": cert.Issuer.CommonName,
+	}
+
+	for k, v := range fields {
+		if k == "cn" {
+			continue
+		}
+
+		list := make([]interface{}, len(v))
+		for i := range v {
+			list[i] = v[i]
+		}
+		claims[k] = list
+	}
+
+	return claims
+}
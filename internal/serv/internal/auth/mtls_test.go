@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dosco/graphjin/core"
+)
+
+func TestMTLSHandler(t *testing.T) {
+	ac := &Auth{Name: "test", Type: "mtls"}
+	ac.MTLS.Rules = []MTLSRule{
+		{Field: "dns", Match: `(.+)\.svc\.internal`, UserID: "$1", Role: "service"},
+		{Match: "admin-.*", Role: "admin"},
+	}
+
+	var userID, role interface{}
+	var claims map[string]interface{}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID = r.Context().Value(core.UserIDKey)
+		role = r.Context().Value(core.UserRoleKey)
+		claims, _ = r.Context().Value(core.UserClaimsKey).(map[string]interface{})
+	})
+
+	h, err := MTLSHandler(ac, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := func(cert *x509.Certificate) {
+		userID, role, claims = nil, nil, nil
+
+		r := httptest.NewRequest("GET", "/", nil)
+		if cert != nil {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	req(&x509.Certificate{
+		Subject:      pkix.Name{CommonName: "billing"},
+		DNSNames:     []string{"billing.svc.internal"},
+		SerialNumber: big.NewInt(10),
+	})
+
+	if userID != "billing" || role != "service" {
+		t.Errorf("expected billing (service) got %v (%v)", userID, role)
+	}
+
+	if claims["cn"] != "billing" || claims["serial"] != "10" {
+		t.Errorf("expected the certificate claims got %v", claims)
+	}
+
+	req(&x509.Certificate{
+		Subject:      pkix.Name{CommonName: "admin-jo"},
+		SerialNumber: big.NewInt(11),
+	})
+
+	if userID != "admin-jo" || role != "admin" {
+		t.Errorf("expected admin-jo (admin) got %v (%v)", userID, role)
+	}
+
+	req(&x509.Certificate{
+		Subject:      pkix.Name{CommonName: "other"},
+		SerialNumber: big.NewInt(12),
+	})
+
+	if userID != nil {
+		t.Errorf("expected an anonymous request got %v", userID)
+	}
+
+	req(nil)
+
+	if userID != nil {
+		t.Errorf("expected an anonymous request without a certificate got %v", userID)
+	}
+
+	ac.MTLS.Rules = []MTLSRule{{Field: "subject"}}
+
+	if _, err := MTLSHandler(ac, next); err == nil {
+		t.Error("expected an error for an invalid field")
+	}
+}
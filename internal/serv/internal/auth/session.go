@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/dosco/graphjin/core"
+)
+
+// maximum number of sessions cached by an auth
+const sessionCacheSize = 1000
+
+// session is the user returned by the auth webhook and api key lookups
+type session struct {
+	UserID         interface{}            `json:"user_id"`
+	UserIDProvider string                 `json:"user_id_provider"`
+	Role           string                 `json:"role"`
+	Claims         map[string]interface{} `json:"claims"`
+}
+
+func (s *session) withContext(ctx context.Context) context.Context {
+	switch v := s.UserID.(type) {
+	case string:
+		if v != "" {
+			ctx = context.WithValue(ctx, core.UserIDKey, v)
+		}
+	case json.Number:
+		ctx = context.WithValue(ctx, core.UserIDKey, v.String())
+	}
+	if s.UserIDProvider != "" {
+		ctx = context.WithValue(ctx, core.UserIDProviderKey, s.UserIDProvider)
+	}
+	if s.Role != "" {
+		ctx = context.WithValue(ctx, core.UserRoleKey, s.Role)
+	}
+	if len(s.Claims) != 0 {
+		ctx = context.WithValue(ctx, core.UserClaimsKey, s.Claims)
+	}
+	return ctx
+}
+
+type sessionEntry struct {
+	key     string
+	sess    *session
+	expires time.Time
+}
+
+// sessionCache caches sessions by a hash of the credentials, a nil
+// session is cached for credentials that did not match a user. The
+// least recently used entries are evicted once the cache is full.
+type sessionCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+func newSessionCache(ttl time.Duration) *sessionCache {
+	return &sessionCache{
+		ttl:     ttl,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *sessionCache) get(key string) (*session, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*sessionEntry)
+	if time.Now().After(e.expires) {
+		c.remove(el)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(el)
+	return e.sess, true
+}
+
+func (c *sessionCache) set(key string, sess *session) {
+	c.Lock()
+	defer c.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*sessionEntry)
+		e.sess, e.expires = sess, expires
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	for c.lru.Len() >= sessionCacheSize {
+		c.remove(c.lru.Back())
+	}
+
+	c.entries[key] = c.lru.PushFront(&sessionEntry{key: key, sess: sess, expires: expires})
+}
+
+func (c *sessionCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*sessionEntry).key)
+}
+
+// hashKey returns the hex encoded SHA256 of the value
+func hashKey(v string) string {
+	h := sha256.Sum256([]byte(v))
+	return hex.EncodeToString(h[:])
+}
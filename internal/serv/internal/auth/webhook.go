@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	webhookTimeout  = 5 * time.Second
+	webhookCacheTTL = time.Minute
+)
+
+// WebhookHandler calls the auth webhook with the configured headers and cookies
+// of the request and sets the user from its response. A 401 or 403 response makes
+// the request anonymous, other failures reject the request unless fail_open is set.
+func WebhookHandler(ac *Auth, next http.Handler) (http.HandlerFunc, error) {
+	wh := ac.Webhook
+
+	if wh.URL == "" {
+		return nil, fmt.Errorf("auth '%s': no webhook.url defined", ac.Name)
+	}
+
+	if len(wh.Headers) == 0 && len(wh.Cookies) == 0 {
+		return nil, fmt.Errorf("auth '%s': no webhook.headers or webhook.cookies defined", ac.Name)
+	}
+
+	method := strings.ToUpper(wh.Method)
+	if method == "" {
+		method = "GET"
+	}
+
+	timeout := wh.Timeout
+	if timeout == 0 {
+		timeout = webhookTimeout
+	}
+
+	ttl := wh.CacheTTL
+	if ttl == 0 {
+		ttl = webhookCacheTTL
+	}
+
+	client := &http.Client{Timeout: timeout}
+	cache := newSessionCache(ttl)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		hdr := webhookHeaders(r, wh.Headers, wh.Cookies)
+
+		// no credentials to forward
+		if len(hdr) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := webhookCacheKey(hdr)
+		sess, ok := cache.get(key)
+
+		if !ok {
+			var err error
+
+			sess, err = callWebhook(r.Context(), client, method, wh.URL, hdr)
+			if err != nil && !wh.FailOpen {
+				http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if err == nil {
+				cache.set(key, sess)
+			}
+		}
+
+		if sess == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(sess.withContext(r.Context())))
+	}, nil
+}
+
+// webhookHeaders returns the headers and cookies to forward
+// to the webhook, cookies are forwarded in a cookie header
+func webhookHeaders(r *http.Request, headers, cookies []string) http.Header {
+	hdr := make(http.Header)
+
+	for _, h := range headers {
+		if v := r.Header.Values(h); len(v) != 0 {
+			hdr[http.CanonicalHeaderKey(h)] = v
+		}
+	}
+
+	var ck []string
+
+	for _, c := range cookies {
+		if v, err := r.Cookie(c); err == nil {
+			ck = append(ck, v.String())
+		}
+	}
+
+	if len(ck) != 0 {
+		hdr.Set("Cookie", strings.Join(ck, "; "))
+	}
+
+	return hdr
+}
+
+func webhookCacheKey(hdr http.Header) string {
+	var b bytes.Buffer
+
+	// the header is written in sorted key order
+	//nolint: errcheck
+	hdr.Write(&b)
+	return hashKey(b.String())
+}
+
+// callWebhook returns a nil session when the webhook
+// responds with a 401 or 403 status
+func callWebhook(
+	ctx context.Context,
+	client *http.Client,
+	method, url string,
+	hdr http.Header) (*session, error) {
+
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = hdr.Clone()
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("auth webhook: %s", res.Status)
+	}
+
+	// the response is decoded as the session
+	var sess session
+
+	d := json.NewDecoder(res.Body)
+	d.UseNumber()
+
+	if err := d.Decode(&sess); err != nil {
+		return nil, fmt.Errorf("auth webhook: %w", err)
+	}
+
+	return &sess, nil
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dosco/graphjin/core"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	var calls int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.Header.Get("X-Token") {
+		case "good":
+			_, _ = w.Write([]byte(`{"user_id": 5, "role": "admin", "claims": {"org_id": 7}}`))
+		case "bad":
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	ac := &Auth{Name: "test", Type: "webhook"}
+	ac.Webhook.URL = ts.URL
+	ac.Webhook.Headers = []string{"X-Token"}
+
+	var userID, role interface{}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID = r.Context().Value(core.UserIDKey)
+		role = r.Context().Value(core.UserRoleKey)
+	})
+
+	h, err := WebhookHandler(ac, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	call := func(h http.HandlerFunc, token string) int {
+		userID, role = nil, nil
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Token", token)
+		w := httptest.NewRecorder()
+		h(w, req)
+		return w.Code
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := call(h, "good"); code != 200 || userID != "5" || role != "admin" {
+			t.Fatalf("expected user 5 with role admin got %d %v %v", code, userID, role)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("expected the response to be cached got %d calls", calls)
+	}
+
+	if code := call(h, "bad"); code != 200 || userID != nil {
+		t.Errorf("expected an anonymous request got %d %v", code, userID)
+	}
+
+	if code := call(h, "error"); code != http.StatusUnauthorized {
+		t.Errorf("expected the request to be rejected got %d", code)
+	}
+
+	ac.Webhook.FailOpen = true
+
+	h, err = WebhookHandler(ac, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := call(h, "error"); code != 200 || userID != nil {
+		t.Errorf("expected an anonymous request got %d %v", code, userID)
+	}
+}
+
+func TestSessionCache(t *testing.T) {
+	c := newSessionCache(time.Minute)
+
+	for i := 0; i < sessionCacheSize; i++ {
+		c.set(strconv.Itoa(i), nil)
+	}
+
+	// keep the first entry in use
+	if _, ok := c.get("0"); !ok {
+		t.Fatal("expected a cached entry")
+	}
+
+	c.set("live", &session{UserID: "1"})
+
+	if len(c.entries) != sessionCacheSize || c.lru.Len() != sessionCacheSize {
+		t.Errorf("expected the cache to be bounded to %d got %d", sessionCacheSize, len(c.entries))
+	}
+
+	if _, ok := c.get("1"); ok {
+		t.Error("expected the least recently used entry to be evicted")
+	}
+
+	if _, ok := c.get("0"); !ok {
+		t.Error("expected the recently used entry to be kept")
+	}
+
+	if s, ok := c.get("live"); !ok || s.UserID != "1" {
+		t.Errorf("expected the live session got %v", s)
+	}
+
+	c.ttl = -time.Second
+	c.set("expired", &session{UserID: "2"})
+
+	if _, ok := c.get("expired"); ok || c.entries["expired"] != nil {
+		t.Error("expected the expired entry to be removed")
+	}
+}
@@ -0,0 +1,205 @@
+// Package cron parses standard five field cron expressions (minute, hour,
+// day of month, month and day of week) and works out when they next run.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// when both day of month and day of week are restricted
+	// a day matching either of them is a match
+	domStar, dowStar bool
+}
+
+type bounds struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minutes = bounds{0, 59, nil}
+	hours   = bounds{0, 23, nil}
+	doms    = bounds{1, 31, nil}
+	months  = bounds{1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dows = bounds{0, 7, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a five field cron expression or one of the
+// descriptors @yearly, @monthly, @weekly, @daily and @hourly
+func Parse(expr string) (*Schedule, error) {
+	var err error
+
+	expr = strings.TrimSpace(expr)
+
+	if v, ok := descriptors[strings.ToLower(expr)]; ok {
+		expr = v
+	}
+
+	f := strings.Fields(expr)
+	if len(f) != 5 {
+		return nil, fmt.Errorf("cron: expected 5 fields found %d: '%s'", len(f), expr)
+	}
+
+	s := &Schedule{
+		domStar: f[2] == "*" || f[2] == "?",
+		dowStar: f[4] == "*" || f[4] == "?",
+	}
+
+	if s.minute, err = parseField(f[0], minutes); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(f[1], hours); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(f[2], doms); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(f[3], months); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseField(f[4], dows); err != nil {
+		return nil, err
+	}
+
+	// 7 is also sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	return s, nil
+}
+
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		v, err := parseRange(part, b)
+		if err != nil {
+			return 0, err
+		}
+		bits |= v
+	}
+	return bits, nil
+}
+
+// parseRange parses *, n, a-b with an optional /step
+func parseRange(expr string, b bounds) (uint64, error) {
+	var err error
+	var bits uint64
+
+	start, end, step := b.min, b.max, 1
+	rs := strings.SplitN(expr, "/", 2)
+
+	if len(rs) == 2 {
+		if step, err = strconv.Atoi(rs[1]); err != nil || step <= 0 {
+			return 0, fmt.Errorf("cron: invalid step: '%s'", expr)
+		}
+	}
+
+	if rs[0] != "*" && rs[0] != "?" {
+		lh := strings.SplitN(rs[0], "-", 2)
+
+		if start, err = parseValue(lh[0], b); err != nil {
+			return 0, err
+		}
+
+		switch {
+		case len(lh) == 2:
+			if end, err = parseValue(lh[1], b); err != nil {
+				return 0, err
+			}
+		case len(rs) == 1:
+			end = start
+		}
+	}
+
+	if start > end {
+		return 0, fmt.Errorf("cron: invalid range: '%s'", expr)
+	}
+
+	for i := start; i <= end; i += step {
+		bits |= 1 << uint(i)
+	}
+	return bits, nil
+}
+
+func parseValue(v string, b bounds) (int, error) {
+	if n, ok := b.names[strings.ToLower(v)]; ok {
+		return n, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("cron: invalid value: '%s'", v)
+	}
+
+	if n < b.min || n > b.max {
+		return 0, fmt.Errorf("cron: value out of range (%d-%d): '%s'", b.min, b.max, v)
+	}
+	return n, nil
+}
+
+// Next returns the first time after t that matches the schedule. A zero
+// time is returned when no match is found in the next five years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,57 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	from := time.Date(2020, time.November, 20, 10, 15, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		exp  time.Time
+	}{
+		{"* * * * *", time.Date(2020, time.November, 20, 10, 16, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2020, time.November, 20, 10, 20, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2020, time.November, 20, 11, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2020, time.November, 21, 2, 30, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2020, time.November, 23, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2020, time.November, 22, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * 1", time.Date(2020, time.November, 23, 0, 0, 0, 0, time.UTC)},
+		{"15,45 8-10 * * *", time.Date(2020, time.November, 20, 10, 45, 0, 0, time.UTC)},
+		{"@daily", time.Date(2020, time.November, 21, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, v := range tests {
+		s, err := Parse(v.expr)
+		if err != nil {
+			t.Errorf("%s: %s", v.expr, err)
+			continue
+		}
+
+		if n := s.Next(from); !n.Equal(v.exp) {
+			t.Errorf("%s: expected %s got %s", v.expr, v.exp, n)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	exprs := []string{
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+	}
+
+	for _, v := range exprs {
+		if _, err := Parse(v); err == nil {
+			t.Errorf("%s: expected error", v)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Package ratelimit counts requests in fixed time windows. The counts are kept
+// in a store, the memory store is used by a single instance and the redis store
+// shares the counts across instances.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store keeps the request counts for the keys
+type Store interface {
+	// Incr adds n to the count for the key and returns the new count and when
+	// the window ends. A new window is started when the key has expired.
+	Incr(c context.Context, key string, n int, window time.Duration) (int, time.Time, error)
+}
+
+// Result is the state of a limit after a request was counted
+type Result struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+	Allowed   bool
+}
+
+// Take counts the request with the cost against the limit for the key
+func Take(c context.Context, s Store, key string, cost, limit int, window time.Duration) (Result, error) {
+	n, reset, err := s.Incr(c, key, cost, window)
+	if err != nil {
+		return Result{}, err
+	}
+
+	res := Result{
+		Limit:     limit,
+		Remaining: limit - n,
+		Reset:     reset,
+		Allowed:   n <= limit,
+	}
+
+	if res.Remaining < 0 {
+		res.Remaining = 0
+	}
+	return res, nil
+}
+
+type counter struct {
+	n     int
+	reset time.Time
+}
+
+// MemoryStore keeps the counts in memory, expired
+// counts are removed every sweep interval
+type MemoryStore struct {
+	sync.Mutex
+	counts    map[string]*counter
+	nextSweep time.Time
+	sweep     time.Duration
+}
+
+// NewMemoryStore returns a memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		counts: make(map[string]*counter),
+		sweep:  time.Minute,
+	}
+}
+
+// Incr adds n to the count for the key
+func (ms *MemoryStore) Incr(c context.Context, key string, n int, window time.Duration) (int, time.Time, error) {
+	now := time.Now()
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	if now.After(ms.nextSweep) {
+		ms.removeExpired(now)
+		ms.nextSweep = now.Add(ms.sweep)
+	}
+
+	v, ok := ms.counts[key]
+	if !ok || !now.Before(v.reset) {
+		v = &counter{reset: now.Add(window)}
+		ms.counts[key] = v
+	}
+	v.n += n
+
+	return v.n, v.reset, nil
+}
+
+// Len returns the number of keys in the store
+func (ms *MemoryStore) Len() int {
+	ms.Lock()
+	defer ms.Unlock()
+	return len(ms.counts)
+}
+
+func (ms *MemoryStore) removeExpired(now time.Time) {
+	for k, v := range ms.counts {
+		if !now.Before(v.reset) {
+			delete(ms.counts, k)
+		}
+	}
+}
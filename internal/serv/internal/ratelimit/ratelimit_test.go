@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTake(t *testing.T) {
+	c := context.Background()
+	ms := NewMemoryStore()
+
+	for i, exp := range []int{3, 1, 0} {
+		res, err := Take(c, ms, "user:1", 2, 5, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Remaining != exp {
+			t.Errorf("request %d: expected %d remaining got %d", i, exp, res.Remaining)
+		}
+
+		if res.Allowed != (i < 2) {
+			t.Errorf("request %d: expected allowed to be %t", i, i < 2)
+		}
+	}
+
+	// a new window is started once the key expires
+	res, err := Take(c, ms, "user:2", 1, 1, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+
+	if res, err = Take(c, ms, "user:2", 1, 1, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Allowed {
+		t.Error("expected the request to be allowed in the new window")
+	}
+
+	ms.nextSweep = time.Time{}
+	time.Sleep(2 * time.Millisecond)
+
+	if _, err := Take(c, ms, "user:3", 1, 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := ms.Len(); n != 2 {
+		t.Errorf("expected the expired key to be removed, %d keys found", n)
+	}
+}
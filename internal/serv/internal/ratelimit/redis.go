@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// the count and its expiry are set together so a key
+// never ends up without an expiry
+var incrScript = redis.NewScript(1, `
+local n = redis.call('INCRBY', KEYS[1], ARGV[1])
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[2])
+  ttl = tonumber(ARGV[2])
+end
+return {n, ttl}
+`)
+
+// RedisStore keeps the counts in redis so they are
+// shared by all the instances using the same redis
+type RedisStore struct {
+	pool   *redis.Pool
+	prefix string
+}
+
+// NewRedisStore returns a redis store for the redis url, the keys
+// are prefixed with the prefix
+func NewRedisStore(url, password, prefix string) (*RedisStore, error) {
+	if url == "" {
+		return nil, fmt.Errorf("no redis url defined")
+	}
+
+	pool := &redis.Pool{
+		MaxIdle:     10,
+		IdleTimeout: 5 * time.Minute,
+		Dial: func() (redis.Conn, error) {
+			c, err := redis.DialURL(url)
+			if err != nil {
+				return nil, err
+			}
+
+			if password != "" {
+				if _, err := c.Do("AUTH", password); err != nil {
+					c.Close()
+					return nil, err
+				}
+			}
+
+			return c, nil
+		},
+	}
+
+	return &RedisStore{pool: pool, prefix: prefix}, nil
+}
+
+// Incr adds n to the count for the key
+func (rs *RedisStore) Incr(c context.Context, key string, n int, window time.Duration) (int, time.Time, error) {
+	conn, err := rs.pool.GetContext(c)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer conn.Close()
+
+	v, err := redis.Int64s(incrScript.Do(conn, rs.prefix+key, n, window.Milliseconds()))
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	if len(v) != 2 {
+		return 0, time.Time{}, fmt.Errorf("redis: unexpected rate limit reply")
+	}
+
+	return int(v[0]), time.Now().Add(time.Duration(v[1]) * time.Millisecond), nil
+}
+
+// Close closes the redis connections
+func (rs *RedisStore) Close() error {
+	return rs.pool.Close()
+}
@@ -14,17 +14,19 @@ import (
 var ipCache cache.Cache
 
 func init() {
-	ipCache, _ = cache.NewCache(cache.MaxKeys(10), cache.TTL(time.Minute*5))
+	ipCache, _ = cache.NewCache(cache.TTL(time.Minute * 5))
 }
 
-func getIPLimiter(ip string) *rate.Limiter {
+func getIPLimiter(sc *ServConfig, ip string) *rate.Limiter {
 	v, exists := ipCache.Get(ip)
 	if !exists {
-		limiter := rate.NewLimiter(1, 3)
-		ipCache.Set(ip, limiter, 0)
-		return limiter
+		v = rate.NewLimiter(rate.Limit(sc.conf.RateLimiter.Rate), sc.conf.RateLimiter.Bucket)
 	}
 
+	// setting the limiter again extends its expiry so only the
+	// limiters of idle ips expire and are removed from the cache
+	ipCache.Set(ip, v, 0)
+
 	return v.(*rate.Limiter)
 }
 
@@ -48,7 +50,7 @@ func rateLimiter(sc *ServConfig, h http.Handler) http.Handler {
 			return
 		}
 
-		if !getIPLimiter(ip).Allow() {
+		if !getIPLimiter(sc, ip).Allow() {
 			http.Error(w, "429 Too Many Requests", http.StatusTooManyRequests)
 			return
 		}
@@ -0,0 +1,272 @@
+package serv
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dosco/graphjin/core"
+	"github.com/dosco/graphjin/internal/serv/internal/cron"
+	"go.uber.org/zap"
+)
+
+const (
+	jobRunsTable = "graphjin_job_runs"
+)
+
+// Job run states
+const (
+	jobRunning = "running"
+	jobSuccess = "success"
+	jobFailed  = "failed"
+)
+
+type jobRunner struct {
+	sc    *ServConfig
+	job   *Job
+	sched *cron.Schedule
+	vars  json.RawMessage
+}
+
+func initJobs(c *Config) error {
+	if len(c.Jobs) == 0 {
+		return nil
+	}
+
+	if c.DBType == "mysql" {
+		return errors.New("jobs are not supported with MySQL")
+	}
+
+	rm := map[string]struct{}{"user": {}, "anon": {}}
+	for _, r := range c.Roles {
+		rm[r.Name] = struct{}{}
+	}
+
+	jm := make(map[string]struct{})
+
+	for i := 0; i < len(c.Jobs); i++ {
+		j := &c.Jobs[i]
+
+		if !identRe.MatchString(j.Name) {
+			return fmt.Errorf("Invalid job name: '%s'", j.Name)
+		}
+
+		if _, ok := jm[j.Name]; ok {
+			return fmt.Errorf("Duplicate job found: %s", j.Name)
+		}
+		jm[j.Name] = struct{}{}
+
+		if _, err := cron.Parse(j.Schedule); err != nil {
+			return fmt.Errorf("Invalid schedule: %s, For job: %s", err, j.Name)
+		}
+
+		if (j.Query == "") == (j.SQL == "") {
+			return fmt.Errorf("Either a query or sql is required, For job: %s", j.Name)
+		}
+
+		// sql jobs run as the database user
+		if j.SQL != "" && (j.Role != "" || j.UserID != "") {
+			return fmt.Errorf("Role and user_id are only used with a query, For job: %s", j.Name)
+		}
+
+		if j.Role != "" {
+			if _, ok := rm[j.Role]; !ok {
+				return fmt.Errorf("Invalid role: %s, For job: %s", j.Role, j.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// startJobs runs each job on its schedule till the returned stop function
+// is called. Each scheduled run is claimed by a single instance of the service
+// by recording it in the job runs table, a database advisory lock also skips
+// runs while the previous one is still running.
+func startJobs(sc *ServConfig) (func(), error) {
+	var runners []*jobRunner
+
+	for i := range sc.conf.Jobs {
+		j := &sc.conf.Jobs[i]
+		jr := &jobRunner{sc: sc, job: j}
+
+		if j.Query != "" {
+			nq, ok := gj.NamedQuery(j.Query)
+			if !ok {
+				return nil, fmt.Errorf("job %s: query not found in allow list: %s", j.Name, j.Query)
+			}
+			if nq.Operation == core.OpSubscription {
+				return nil, fmt.Errorf("job %s: subscriptions cannot be run as jobs: %s", j.Name, j.Query)
+			}
+		}
+
+		s, err := cron.Parse(j.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		jr.sched = s
+
+		if len(j.Vars) != 0 {
+			if jr.vars, err = json.Marshal(j.Vars); err != nil {
+				return nil, fmt.Errorf("job %s: %w", j.Name, err)
+			}
+		}
+		runners = append(runners, jr)
+	}
+
+	_, err := sc.db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id           bigserial PRIMARY KEY,
+		job_name     text NOT NULL,
+		status       text NOT NULL,
+		error        text,
+		scheduled_at timestamptz,
+		started_at   timestamptz NOT NULL DEFAULT now(),
+		finished_at  timestamptz,
+		UNIQUE (job_name, scheduled_at)
+	)`, quoteIdent(jobRunsTable)))
+	if err != nil {
+		return nil, err
+	}
+
+	c, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+
+	for _, jr := range runners {
+		wg.Add(1)
+
+		go func(jr *jobRunner) {
+			defer wg.Done()
+			jr.schedule(c)
+		}(jr)
+	}
+
+	stop := func() {
+		cancel()
+		wg.Wait()
+	}
+
+	return stop, nil
+}
+
+func (jr *jobRunner) schedule(c context.Context) {
+	for {
+		next := jr.sched.Next(time.Now())
+		if next.IsZero() {
+			jr.sc.zlog.Warn("Job has no next run", zap.String("job", jr.job.Name))
+			return
+		}
+
+		t := time.NewTimer(time.Until(next))
+
+		select {
+		case <-c.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+
+		jr.run(c, next)
+	}
+}
+
+// run runs the job for the scheduled time, the scheduled time is unique
+// for a job so only the first instance to record it runs the job.
+func (jr *jobRunner) run(c context.Context, scheduled time.Time) {
+	var locked bool
+	var runID int64
+
+	name := jr.job.Name
+	key := "graphjin_job_" + name
+
+	conn, err := jr.sc.db.Conn(c)
+	if err != nil {
+		jr.sc.zlog.Error("Job failed", zap.String("job", name), zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	err = conn.QueryRowContext(c, `SELECT pg_try_advisory_lock(hashtext($1))`, key).Scan(&locked)
+	if err != nil {
+		jr.sc.zlog.Error("Job failed", zap.String("job", name), zap.Error(err))
+		return
+	}
+
+	// the job is already running on this or another instance
+	if !locked {
+		jr.sc.zlog.Info("Job skipped, already running", zap.String("job", name))
+		return
+	}
+
+	//nolint: errcheck
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, key)
+
+	err = conn.QueryRowContext(c, fmt.Sprintf(
+		`INSERT INTO %s (job_name, status, scheduled_at) VALUES ($1, $2, $3)
+		ON CONFLICT (job_name, scheduled_at) DO NOTHING RETURNING id`, quoteIdent(jobRunsTable)),
+		name, jobRunning, scheduled).Scan(&runID)
+
+	// the scheduled run was claimed by another instance
+	if err == sql.ErrNoRows {
+		jr.sc.zlog.Info("Job skipped, already run", zap.String("job", name))
+		return
+	}
+
+	if err != nil {
+		jr.sc.zlog.Error("Job failed", zap.String("job", name), zap.Error(err))
+		return
+	}
+
+	st := time.Now()
+	err = jr.exec(c, conn)
+	dur := time.Since(st)
+
+	status := jobSuccess
+	var errMsg sql.NullString
+
+	if err != nil {
+		status = jobFailed
+		errMsg = sql.NullString{String: err.Error(), Valid: true}
+		jr.sc.zlog.Error("Job failed",
+			zap.String("job", name), zap.Duration("duration", dur), zap.Error(err))
+	} else {
+		jr.sc.zlog.Info("Job completed",
+			zap.String("job", name), zap.Duration("duration", dur))
+	}
+
+	_, err = conn.ExecContext(context.Background(), fmt.Sprintf(
+		`UPDATE %s SET status = $2, error = $3, finished_at = now() WHERE id = $1`, quoteIdent(jobRunsTable)),
+		runID, status, errMsg)
+	if err != nil {
+		jr.sc.zlog.Error("Job history", zap.String("job", name), zap.Error(err))
+	}
+}
+
+func (jr *jobRunner) exec(c context.Context, conn *sql.Conn) error {
+	if jr.job.SQL != "" {
+		_, err := conn.ExecContext(c, jr.job.SQL)
+		return err
+	}
+
+	if jr.job.UserID != "" {
+		c = context.WithValue(c, core.UserIDKey, jr.job.UserID)
+	}
+
+	if jr.job.Role != "" {
+		c = context.WithValue(c, core.UserRoleKey, jr.job.Role)
+	}
+
+	res, err := gj.GraphQLByName(c, jr.job.Query, jr.vars, nil)
+	if err != nil {
+		return err
+	}
+
+	if res.Error != "" {
+		return errors.New(res.Error)
+	}
+
+	return nil
+}
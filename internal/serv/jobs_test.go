@@ -0,0 +1,37 @@
+package serv
+
+import (
+	"testing"
+
+	"github.com/dosco/graphjin/core"
+)
+
+func TestInitJobs(t *testing.T) {
+	c := &Config{}
+	c.Roles = []core.Role{{Name: "admin"}}
+	c.Jobs = []Job{
+		{Name: "refresh", Schedule: "@hourly", SQL: "REFRESH MATERIALIZED VIEW leaders"},
+		{Name: "report", Schedule: "0 9 * * mon", Query: "getReport", Role: "admin"},
+	}
+
+	if err := initJobs(c); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []Job{
+		{Name: "bad_schedule", Schedule: "* * *", SQL: "SELECT 1"},
+		{Name: "no_action", Schedule: "@daily"},
+		{Name: "both", Schedule: "@daily", SQL: "SELECT 1", Query: "getReport"},
+		{Name: "bad_role", Schedule: "@daily", Query: "getReport", Role: "root"},
+		{Name: "sql_role", Schedule: "@daily", SQL: "SELECT 1", Role: "admin"},
+		{Name: "refresh", Schedule: "@daily", SQL: "SELECT 1"},
+	}
+
+	for _, v := range tests {
+		c.Jobs = []Job{c.Jobs[0], v}
+
+		if err := initJobs(c); err == nil {
+			t.Errorf("%s: expected error", v.Name)
+		}
+	}
+}
@@ -0,0 +1,472 @@
+package serv
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/dosco/graphjin/core"
+	"github.com/dosco/graphjin/internal/serv/internal/auth"
+	"go.uber.org/zap"
+)
+
+type oaObj = map[string]interface{}
+
+// apiV1OpenAPI serves an OpenAPI 3 document for the REST endpoints of the
+// named queries in the allow list and for the actions. In production the document is
+// generated on the first request since the allow list does not change while the
+// service runs, in development it's generated on every request.
+func apiV1OpenAPI(servConf *ServConfig) http.HandlerFunc {
+	var once sync.Once
+	var pdoc []byte
+	var perr error
+
+	gen := func() ([]byte, error) {
+		return json.Marshal(openAPIDoc(servConf, gj.NamedQueries(), gj.QueryFields))
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var doc []byte
+		var err error
+
+		if servConf.conf.Production {
+			once.Do(func() { pdoc, perr = gen() })
+			doc, err = pdoc, perr
+		} else {
+			doc, err = gen()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err != nil {
+			renderErr(w, err)
+			return
+		}
+
+		w.Write(doc) //nolint: errcheck
+	}
+}
+
+type queryFieldsFn func(name, role string) ([]core.QueryField, error)
+
+func openAPIDoc(servConf *ServConfig, queries []core.NamedQuery, fieldsFn queryFieldsFn) oaObj {
+	conf := servConf.conf
+	paths := oaObj{}
+
+	title := conf.AppName
+	if title == "" {
+		title = "GraphJin API"
+	}
+
+	// the response schema is for authenticated users
+	// unless no auth is configured
+	role := "user"
+	if conf.Auth.Type == "" || conf.Auth.Type == "none" {
+		role = "anon"
+	}
+
+	secSchemes, security := openAPISecurity(servConf, conf.Auth, conf.Auth.Type+"Auth")
+
+	qm := make(map[string]core.NamedQuery, len(queries))
+
+	for _, nq := range queries {
+		if nq.Operation != core.OpQuery && nq.Operation != core.OpMutation {
+			continue
+		}
+		qm[nq.Name] = nq
+
+		method, op := openAPIOperation(servConf, nq, role, fieldsFn)
+		op["operationId"] = nq.Name
+
+		if len(security) != 0 {
+			op["security"] = security
+		}
+
+		paths[restRoute+nq.Name] = oaObj{method: op}
+	}
+
+	for _, a := range conf.Actions {
+		var method string
+		var op oaObj
+
+		switch {
+		case a.Query != "":
+			nq, ok := qm[a.Query]
+			if !ok {
+				continue
+			}
+			method, op = openAPIOperation(servConf, nq, role, fieldsFn)
+
+		case a.SQL != "":
+			method = "post"
+			op = oaObj{"responses": oaObj{
+				"200": oaObj{"description": "The " + a.Name + " action was run"},
+			}}
+
+		default:
+			method = "post"
+			if a.Webhook.Method != "" {
+				method = strings.ToLower(a.Webhook.Method)
+			}
+			op = oaObj{"responses": oaObj{
+				"default": oaObj{"description": "Response of the " + a.Name + " webhook"},
+			}}
+		}
+
+		op["operationId"] = "action_" + a.Name
+
+		// actions only use the auth named by the action
+		if ac := findAuth(servConf, a.AuthName); ac != nil {
+			ss, sec := openAPISecurity(servConf, *ac, ac.Name+"Auth")
+			for k, v := range ss {
+				secSchemes[k] = v
+			}
+			if len(sec) != 0 {
+				op["security"] = sec
+			}
+		}
+
+		paths["/api/v1/actions/"+strings.ToLower(a.Name)] = oaObj{method: op}
+	}
+
+	comp := oaObj{
+		"schemas": oaObj{
+			"Error": oaObj{
+				"type":       "object",
+				"properties": oaObj{"error": oaObj{"type": "string"}},
+			},
+		},
+		"responses": oaObj{
+			"Error": oaObj{
+				"description": "Error",
+				"content": oaObj{
+					"application/json": oaObj{
+						"schema": oaObj{"$ref": "#/components/schemas/Error"},
+					},
+				},
+			},
+		},
+	}
+
+	if len(secSchemes) != 0 {
+		comp["securitySchemes"] = secSchemes
+	}
+
+	return oaObj{
+		"openapi":    "3.1.0",
+		"info":       oaObj{"title": title, "version": "1.0.0"},
+		"paths":      paths,
+		"components": comp,
+	}
+}
+
+// openAPIOperation returns the method and the operation for the REST endpoint
+// of a named query, the variables are either url query params or the json body.
+func openAPIOperation(servConf *ServConfig, nq core.NamedQuery, role string, fieldsFn queryFieldsFn) (string, oaObj) {
+	data := oaObj{"type": "object"}
+
+	fields, err := fieldsFn(nq.Name, role)
+	if err == nil {
+		data = openAPIFields(fields)
+	} else if servConf.zlog != nil {
+		servConf.zlog.Warn("OpenAPI", zap.String("query", nq.Name), zap.Error(err))
+	}
+
+	op := oaObj{
+		"responses": oaObj{
+			"200": oaObj{
+				"description": "Result of the " + nq.Name + " operation",
+				"content": oaObj{
+					"application/json": oaObj{"schema": oaObj{
+						"type":       "object",
+						"properties": oaObj{"data": data},
+					}},
+				},
+			},
+			"400": oaObj{"$ref": "#/components/responses/Error"},
+			"401": oaObj{"$ref": "#/components/responses/Error"},
+			"404": oaObj{"$ref": "#/components/responses/Error"},
+		},
+	}
+
+	if nq.Comment != "" {
+		op["summary"] = strings.TrimSpace(nq.Comment)
+	}
+
+	if nq.Operation == core.OpMutation {
+		props, req := oaObj{}, []string{}
+
+		for _, v := range nq.Vars {
+			props[v.Name] = openAPIVarSchema(v)
+			if v.Required {
+				req = append(req, v.Name)
+			}
+		}
+
+		body := oaObj{"type": "object", "properties": props}
+		if len(req) != 0 {
+			body["required"] = req
+		}
+
+		op["requestBody"] = oaObj{
+			"required": len(req) != 0,
+			"content": oaObj{
+				"application/json": oaObj{"schema": body},
+			},
+		}
+		return "post", op
+	}
+
+	if len(nq.Vars) != 0 {
+		var params []oaObj
+
+		for _, v := range nq.Vars {
+			p := oaObj{
+				"name":     v.Name,
+				"in":       "query",
+				"required": v.Required,
+				"schema":   openAPIVarSchema(v),
+			}
+
+			if v.List {
+				p["explode"] = true
+			} else if _, ok := openAPIScalars[v.Type]; !ok {
+				// input objects are passed as json
+				p["content"] = oaObj{"application/json": oaObj{"schema": p["schema"]}}
+				delete(p, "schema")
+			}
+			params = append(params, p)
+		}
+		op["parameters"] = params
+	}
+
+	return "get", op
+}
+
+// openAPISecurity returns the security scheme for the auth
+// and the security requirement of the operations using it
+func openAPISecurity(servConf *ServConfig, a auth.Auth, name string) (oaObj, []oaObj) {
+	var ss oaObj
+
+	switch a.Type {
+	case "jwt":
+		if a.Cookie != "" {
+			ss = oaObj{"type": "apiKey", "in": "cookie", "name": a.Cookie}
+		} else {
+			ss = oaObj{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"}
+		}
+
+	case "rails":
+		ss = oaObj{"type": "apiKey", "in": "cookie", "name": a.Cookie}
+
+	case "header":
+		ss = oaObj{"type": "apiKey", "in": "header", "name": a.Header.Name}
+
+	case "mtls":
+		ss = oaObj{"type": "mutualTLS", "description": "A client certificate signed by the client CA"}
+
+	case "webhook":
+		return openAPIKeys(name, a.Webhook.Headers, a.Webhook.Cookies, nil)
+
+	case "api_key":
+		ak := a.APIKey
+		if ak.Header == "" {
+			ak.Header = "X-API-Key"
+		}
+
+		var params []string
+		if ak.Param != "" {
+			params = []string{ak.Param}
+		}
+		return openAPIKeys(name, []string{ak.Header}, nil, params)
+
+	case "chain":
+		return openAPIChain(servConf, a.Chain)
+
+	default:
+		return oaObj{}, nil
+	}
+
+	return oaObj{name: ss}, []oaObj{{name: []string{}}}
+}
+
+// openAPIKeys returns a scheme for each of the headers, cookies and
+// query params, any one of them can be used to authenticate
+func openAPIKeys(name string, headers, cookies, params []string) (oaObj, []oaObj) {
+	ss := oaObj{}
+	var sec []oaObj
+
+	add := func(in string, keys []string) {
+		for _, k := range keys {
+			n := name + "." + k
+			ss[n] = oaObj{"type": "apiKey", "in": in, "name": k}
+			sec = append(sec, oaObj{n: []string{}})
+		}
+	}
+	add("header", headers)
+	add("cookie", cookies)
+	add("query", params)
+
+	if len(sec) == 0 {
+		return oaObj{}, nil
+	}
+	return ss, sec
+}
+
+// openAPIChain returns the schemes of the chained auths, any one of them can be
+// used to authenticate. Header auths reject requests without the header so
+// they are required along with each of the others.
+func openAPIChain(servConf *ServConfig, chain []string) (oaObj, []oaObj) {
+	ss := oaObj{}
+	gate := oaObj{}
+	var alts []oaObj
+
+	for _, name := range chain {
+		ac := findAuth(servConf, name)
+		if ac == nil || ac.Type == "chain" {
+			continue
+		}
+
+		s, sec := openAPISecurity(servConf, *ac, ac.Name+"Auth")
+		for k, v := range s {
+			ss[k] = v
+		}
+
+		if ac.Type != "header" {
+			alts = append(alts, sec...)
+			continue
+		}
+
+		for _, req := range sec {
+			for k, v := range req {
+				gate[k] = v
+			}
+		}
+	}
+
+	if len(alts) == 0 {
+		alts = []oaObj{{}}
+	}
+
+	var sec []oaObj
+	for _, req := range alts {
+		r := oaObj{}
+		for k, v := range gate {
+			r[k] = v
+		}
+		for k, v := range req {
+			r[k] = v
+		}
+		if len(r) != 0 {
+			sec = append(sec, r)
+		}
+	}
+
+	return ss, sec
+}
+
+var openAPIScalars = map[string]oaObj{
+	"Int":     {"type": "integer"},
+	"Float":   {"type": "number"},
+	"Boolean": {"type": "boolean"},
+	"String":  {"type": "string"},
+	"ID":      {"type": "string"},
+}
+
+func openAPIVarSchema(v core.QueryVar) oaObj {
+	s, ok := openAPIScalars[v.Type]
+	if !ok {
+		s = oaObj{"type": "object"}
+	}
+
+	if v.List {
+		return oaObj{"type": "array", "items": s}
+	}
+	return s
+}
+
+func openAPIFields(fields []core.QueryField) oaObj {
+	props := oaObj{}
+
+	for _, f := range fields {
+		props[f.Name] = openAPIField(f)
+	}
+
+	return oaObj{"type": "object", "properties": props}
+}
+
+func openAPIField(f core.QueryField) oaObj {
+	var s oaObj
+
+	// nested selection
+	if f.List || len(f.Fields) != 0 {
+		s = openAPIFields(f.Fields)
+
+		if f.List {
+			return oaObj{"type": "array", "items": s}
+		}
+		return openAPINullable(s)
+	}
+
+	s = openAPIColType(f.Type)
+
+	if f.Array {
+		s = oaObj{"type": "array", "items": s}
+	}
+
+	if !f.NotNull {
+		s = openAPINullable(s)
+	}
+	return s
+}
+
+// openAPINullable allows null values for the schema, schemas
+// without a type like json columns already allow them
+func openAPINullable(s oaObj) oaObj {
+	if t, ok := s["type"].(string); ok {
+		s["type"] = []string{t, "null"}
+	}
+	return s
+}
+
+// openAPIColType maps database column types to json schema types
+func openAPIColType(t string) oaObj {
+	t = strings.ToLower(t)
+
+	switch {
+	case t == "smallint", t == "integer", t == "int", t == "int2", t == "int4",
+		t == "serial", t == "smallserial", t == "tinyint", t == "mediumint":
+		return oaObj{"type": "integer", "format": "int32"}
+
+	case t == "bigint", t == "int8", t == "bigserial":
+		return oaObj{"type": "integer", "format": "int64"}
+
+	case t == "real", t == "float4", t == "float":
+		return oaObj{"type": "number", "format": "float"}
+
+	case t == "double precision", t == "float8", t == "double":
+		return oaObj{"type": "number", "format": "double"}
+
+	case strings.HasPrefix(t, "numeric"), strings.HasPrefix(t, "decimal"), t == "money":
+		return oaObj{"type": "number"}
+
+	case t == "boolean", t == "bool":
+		return oaObj{"type": "boolean"}
+
+	case t == "json", t == "jsonb":
+		return oaObj{}
+
+	case t == "uuid":
+		return oaObj{"type": "string", "format": "uuid"}
+
+	case t == "date":
+		return oaObj{"type": "string", "format": "date"}
+
+	case strings.HasPrefix(t, "timestamp"), t == "datetime":
+		return oaObj{"type": "string", "format": "date-time"}
+
+	default:
+		return oaObj{"type": "string"}
+	}
+}
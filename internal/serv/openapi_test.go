@@ -0,0 +1,218 @@
+package serv
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dosco/graphjin/core"
+	"github.com/dosco/graphjin/internal/serv/internal/auth"
+	"go.uber.org/zap"
+)
+
+func TestOpenAPIDoc(t *testing.T) {
+	sc := &ServConfig{conf: &Config{}}
+	sc.conf.AppName = "Shop"
+	sc.conf.Auth.Type = "jwt"
+
+	sc.conf.Auths = []auth.Auth{{Name: "admin", Type: "header"}}
+	sc.conf.Auths[0].Header.Name = "X-Admin-Key"
+
+	sc.conf.Actions = []Action{
+		{Name: "topProducts", Query: "getProducts", AuthName: "admin"},
+		{Name: "refresh", SQL: "REFRESH MATERIALIZED VIEW leaders"},
+		{Name: "notify"},
+	}
+	sc.conf.Actions[2].Webhook.URL = "http://localhost/notify"
+	sc.conf.Actions[2].Webhook.Method = "PUT"
+
+	queries := []core.NamedQuery{
+		{
+			Name:      "getProducts",
+			Comment:   "List products",
+			Operation: core.OpQuery,
+			Vars: []core.QueryVar{
+				{Name: "limit", Type: "Int", Required: true},
+				{Name: "where", Type: "products_expression"},
+			},
+		},
+		{
+			Name:      "createProduct",
+			Operation: core.OpMutation,
+			Vars:      []core.QueryVar{{Name: "data", Type: "products_insert", Required: true}},
+		},
+	}
+
+	fieldsFn := func(name, role string) ([]core.QueryField, error) {
+		if role != "user" {
+			t.Errorf("expected role 'user' got '%s'", role)
+		}
+
+		return []core.QueryField{{
+			Name: "products",
+			List: true,
+			Fields: []core.QueryField{
+				{Name: "id", Type: "bigint", NotNull: true},
+				{Name: "tags", Type: "text", Array: true},
+				{Name: "user", Fields: []core.QueryField{{Name: "email", Type: "character varying"}}},
+			},
+		}}, nil
+	}
+
+	b, err := json.Marshal(openAPIDoc(sc, queries, fieldsFn))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Info  struct{ Title string }
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+			Summary     string
+			Security    []map[string][]string
+			Parameters  []struct {
+				Name     string
+				Required bool
+				Schema   json.RawMessage
+				Content  json.RawMessage
+			}
+			RequestBody *struct{ Required bool } `json:"requestBody"`
+			Responses   map[string]struct {
+				Content map[string]struct{ Schema json.RawMessage }
+			}
+		}
+		Components struct {
+			SecuritySchemes map[string]json.RawMessage `json:"securitySchemes"`
+		}
+	}
+
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Info.Title != "Shop" {
+		t.Errorf("unexpected title: %s", doc.Info.Title)
+	}
+
+	get := doc.Paths["/api/v1/rest/getProducts"]["get"]
+
+	if get.OperationID != "getProducts" || get.Summary != "List products" {
+		t.Errorf("unexpected operation: %+v", get)
+	}
+
+	if len(get.Parameters) != 2 || !get.Parameters[0].Required ||
+		string(get.Parameters[0].Schema) != `{"type":"integer"}` || get.Parameters[1].Content == nil {
+		t.Errorf("unexpected parameters: %s", b)
+	}
+
+	if len(get.Security) != 1 || doc.Components.SecuritySchemes["jwtAuth"] == nil {
+		t.Errorf("expected jwt security scheme")
+	}
+
+	exp := `{"properties":{"data":{"properties":{"products":{"items":{"properties":{` +
+		`"id":{"format":"int64","type":"integer"},` +
+		`"tags":{"items":{"type":"string"},"type":["array","null"]},` +
+		`"user":{"properties":{"email":{"type":["string","null"]}},"type":["object","null"]}` +
+		`},"type":"object"},"type":"array"}},"type":"object"}},"type":"object"}`
+
+	if v := string(get.Responses["200"].Content["application/json"].Schema); v != exp {
+		t.Errorf("expected response schema:\n%s\ngot:\n%s", exp, v)
+	}
+
+	post := doc.Paths["/api/v1/rest/createProduct"]["post"]
+
+	if post.RequestBody == nil || !post.RequestBody.Required {
+		t.Errorf("expected a required request body")
+	}
+
+	action := doc.Paths["/api/v1/actions/topproducts"]["get"]
+
+	if action.OperationID != "action_topProducts" || len(action.Parameters) != 2 {
+		t.Errorf("unexpected query action: %+v", action)
+	}
+
+	if len(action.Security) != 1 || action.Security[0]["adminAuth"] == nil ||
+		doc.Components.SecuritySchemes["adminAuth"] == nil {
+		t.Errorf("expected the action to use the admin auth: %+v", action.Security)
+	}
+
+	if _, ok := doc.Paths["/api/v1/actions/refresh"]["post"]; !ok {
+		t.Error("expected a post operation for the sql action")
+	}
+
+	if _, ok := doc.Paths["/api/v1/actions/notify"]["put"]; !ok {
+		t.Error("expected a put operation for the webhook action")
+	}
+}
+
+func TestOpenAPISecurity(t *testing.T) {
+	wh := auth.Auth{Type: "webhook"}
+	wh.Webhook.Headers = []string{"Authorization"}
+	wh.Webhook.Cookies = []string{"session"}
+
+	sc := &ServConfig{conf: &Config{}}
+	sc.conf.Auths = []auth.Auth{
+		{Name: "gate", Type: "header"},
+		{Name: "bearer", Type: "jwt"},
+		{Name: "service", Type: "mtls"},
+		{Name: "session", Type: "rails", Cookie: "_app_session"},
+	}
+	sc.conf.Auths[0].Header.Name = "X-Gate"
+
+	ch := auth.Auth{Type: "chain", Chain: []string{"gate", "bearer", "session"}}
+	ch2 := auth.Auth{Type: "chain", Chain: []string{"service", "bearer"}}
+
+	ak := auth.Auth{Type: "api_key"}
+	ak.APIKey.Param = "api_key"
+
+	tests := []struct {
+		name string
+		ac   auth.Auth
+		exp  string
+	}{
+		{"webhook", wh, `{"webhookAuth.Authorization":{"in":"header","name":"Authorization","type":"apiKey"},` +
+			`"webhookAuth.session":{"in":"cookie","name":"session","type":"apiKey"}} ` +
+			`[{"webhookAuth.Authorization":[]},{"webhookAuth.session":[]}]`},
+		{"api_key", ak, `{"api_keyAuth.X-API-Key":{"in":"header","name":"X-API-Key","type":"apiKey"},` +
+			`"api_keyAuth.api_key":{"in":"query","name":"api_key","type":"apiKey"}} ` +
+			`[{"api_keyAuth.X-API-Key":[]},{"api_keyAuth.api_key":[]}]`},
+		{"chain", ch, `{"bearerAuth":{"bearerFormat":"JWT","scheme":"bearer","type":"http"},` +
+			`"gateAuth":{"in":"header","name":"X-Gate","type":"apiKey"},` +
+			`"sessionAuth":{"in":"cookie","name":"_app_session","type":"apiKey"}} ` +
+			`[{"bearerAuth":[],"gateAuth":[]},{"gateAuth":[],"sessionAuth":[]}]`},
+		{"mtls", auth.Auth{Type: "mtls"}, `{"mtlsAuth":{"description":"A client certificate signed by the client CA",` +
+			`"type":"mutualTLS"}} [{"mtlsAuth":[]}]`},
+		{"chain_mtls", ch2, `{"bearerAuth":{"bearerFormat":"JWT","scheme":"bearer","type":"http"},` +
+			`"serviceAuth":{"description":"A client certificate signed by the client CA","type":"mutualTLS"}} ` +
+			`[{"serviceAuth":[]},{"bearerAuth":[]}]`},
+	}
+
+	for _, v := range tests {
+		ss, sec := openAPISecurity(sc, v.ac, v.ac.Type+"Auth")
+
+		b1, _ := json.Marshal(ss)
+		b2, _ := json.Marshal(sec)
+
+		if got := string(b1) + " " + string(b2); got != v.exp {
+			t.Errorf("%s: expected:\n%s\ngot:\n%s", v.name, v.exp, got)
+		}
+	}
+}
+
+func TestOpenAPIRouteProduction(t *testing.T) {
+	sc := &ServConfig{conf: &Config{}, zlog: zap.NewNop()}
+	sc.conf.Production = true
+
+	h, err := routeHandler(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", oaRoute, nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected the openapi document not to be served in production, got %d", w.Code)
+	}
+}
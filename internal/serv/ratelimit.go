@@ -0,0 +1,273 @@
+package serv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dosco/graphjin/core"
+	"github.com/dosco/graphjin/internal/serv/internal/auth"
+	"github.com/dosco/graphjin/internal/serv/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+const (
+	rateLimitWindow      = time.Minute
+	rateLimitRedisPrefix = "graphjin:ratelimit:"
+)
+
+var errRateLimited = errors.New("rate limit exceeded")
+
+type rateLimits struct {
+	limits []RateLimit
+	store  ratelimit.Store
+	zlog   *zap.Logger
+
+	// byRole is set when a limit needs the role of the user
+	byRole bool
+	// roleFn resolves the role of users that the auth did not set one for
+	roleFn func(context.Context) (string, error)
+}
+
+// newRateLimits returns nil when no rate limits are defined
+func newRateLimits(sc *ServConfig) (*rateLimits, error) {
+	rc := sc.conf.RateLimiter
+
+	if len(rc.Limits) == 0 {
+		return nil, nil
+	}
+
+	rl := &rateLimits{zlog: sc.zlog}
+
+	for i, l := range rc.Limits {
+		if l.Name == "" {
+			l.Name = "limit_" + strconv.Itoa(i+1)
+		}
+
+		switch l.By {
+		case "":
+			l.By = "user"
+		case "user", "api_key", "role":
+		default:
+			return nil, fmt.Errorf("rate_limiter: %s: invalid by: %s", l.Name, l.By)
+		}
+
+		for _, op := range l.Operations {
+			switch op {
+			case "query", "mutation", "subscription":
+			default:
+				return nil, fmt.Errorf("rate_limiter: %s: invalid operation: %s", l.Name, op)
+			}
+		}
+
+		if l.Limit <= 0 {
+			return nil, fmt.Errorf("rate_limiter: %s: limit must be greater than 0", l.Name)
+		}
+
+		if l.Window == 0 {
+			l.Window = rateLimitWindow
+		}
+
+		if l.Cost == 0 {
+			l.Cost = 1
+		}
+
+		if l.By == "role" || len(l.Roles) != 0 {
+			rl.byRole = true
+		}
+
+		rl.limits = append(rl.limits, l)
+	}
+
+	// with a roles query the role comes from the database
+	if rl.byRole && gj != nil {
+		rl.roleFn = gj.UserRole
+	}
+
+	switch rc.Store {
+	case "", "memory":
+		rl.store = ratelimit.NewMemoryStore()
+
+	case "redis":
+		prefix := rc.Redis.Prefix
+		if prefix == "" {
+			prefix = rateLimitRedisPrefix
+		}
+
+		rs, err := ratelimit.NewRedisStore(rc.Redis.URL, rc.Redis.Password, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("rate_limiter: %w", err)
+		}
+		rl.store = rs
+
+	default:
+		return nil, fmt.Errorf("rate_limiter: invalid store: %s", rc.Store)
+	}
+
+	return rl, nil
+}
+
+// take counts the request against the limits that apply to it and returns the
+// limit closest to being reached, false is returned when no limit applies.
+func (rl *rateLimits) take(c context.Context, op core.OpType) (ratelimit.Result, bool, error) {
+	var res ratelimit.Result
+	var found bool
+	var role string
+
+	if rl.byRole {
+		role = rl.userRole(c)
+	}
+
+	for _, l := range rl.limits {
+		if !limitApplies(l, op, role) {
+			continue
+		}
+
+		id := limitID(c, l.By, role)
+		if id == "" {
+			continue
+		}
+
+		key := l.Name + ":" + l.By + ":" + id
+
+		r, err := ratelimit.Take(c, rl.store, key, l.Cost, l.Limit, l.Window)
+		if err != nil {
+			return res, false, err
+		}
+
+		if !found || (res.Allowed && !r.Allowed) ||
+			(res.Allowed == r.Allowed && r.Remaining < res.Remaining) {
+			res = r
+		}
+		found = true
+	}
+
+	return res, found, nil
+}
+
+// check returns an error when a rate limit is exceeded, the request
+// is allowed when the limits cannot be read from the store
+func (rl *rateLimits) check(c context.Context, op core.OpType) error {
+	if rl == nil {
+		return nil
+	}
+
+	res, ok, err := rl.take(c, op)
+	if err != nil {
+		rl.zlog.Error("Rate limiter", zap.Error(err))
+		return nil
+	}
+
+	if ok && !res.Allowed {
+		return errRateLimited
+	}
+	return nil
+}
+
+// allow sets the RateLimit headers and responds with a
+// 429 status when a rate limit is exceeded
+func (rl *rateLimits) allow(w http.ResponseWriter, r *http.Request, op core.OpType) bool {
+	if rl == nil {
+		return true
+	}
+
+	res, ok, err := rl.take(r.Context(), op)
+	if err != nil {
+		rl.zlog.Error("Rate limiter", zap.Error(err))
+		return true
+	}
+
+	if !ok {
+		return true
+	}
+
+	reset := strconv.Itoa(int(math.Ceil(time.Until(res.Reset).Seconds())))
+
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", reset)
+
+	if !res.Allowed {
+		h.Set("Retry-After", reset)
+		h.Set("Content-Type", "application/json")
+		renderRestErr(w, http.StatusTooManyRequests, errRateLimited)
+		return false
+	}
+
+	return true
+}
+
+func limitApplies(l RateLimit, op core.OpType, role string) bool {
+	if len(l.Operations) != 0 && !hasString(l.Operations, op.String()) {
+		return false
+	}
+
+	if len(l.Roles) == 0 {
+		return true
+	}
+
+	// users with multiple roles have them as a comma separated list
+	for _, r := range strings.Split(role, ",") {
+		if hasString(l.Roles, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// limitID returns the id the requests are counted by,
+// empty when the request does not have one
+func limitID(c context.Context, by, role string) string {
+	switch by {
+	case "user":
+		if v := c.Value(core.UserIDKey); v != nil {
+			return fmt.Sprintf("%v", v)
+		}
+
+	case "api_key":
+		if v, ok := auth.APIKeyHash(c); ok {
+			return v
+		}
+
+	case "role":
+		return role
+	}
+
+	return ""
+}
+
+// userRole returns the role set by the auth or else the role resolved for the
+// user, requests the role cannot be resolved for are counted as the user role
+func (rl *rateLimits) userRole(c context.Context) string {
+	if v, ok := c.Value(core.UserRoleKey).(string); ok && v != "" {
+		return v
+	}
+
+	if c.Value(core.UserIDKey) == nil {
+		return "anon"
+	}
+
+	if rl.roleFn != nil {
+		role, err := rl.roleFn(c)
+		if err == nil {
+			return role
+		}
+		rl.zlog.Error("Rate limiter", zap.Error(err))
+	}
+	return "user"
+}
+
+func hasString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package serv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dosco/graphjin/core"
+	"go.uber.org/zap"
+)
+
+func TestRateLimits(t *testing.T) {
+	sc := &ServConfig{conf: &Config{}, zlog: zap.NewNop()}
+	sc.conf.RateLimiter.Limits = []RateLimit{
+		{Name: "mutations", Operations: []string{"mutation"}, Limit: 4, Cost: 2},
+		{Name: "admins", By: "role", Roles: []string{"admin"}, Limit: 1},
+	}
+
+	rl, err := newRateLimits(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := func(c context.Context, op core.OpType) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/v1/graphql", nil).WithContext(c)
+		rl.allow(w, r, op)
+		return w
+	}
+
+	c := context.WithValue(context.Background(), core.UserIDKey, 5)
+
+	if w := req(c, core.OpQuery); w.Header().Get("RateLimit-Limit") != "" {
+		t.Error("expected no limit for queries")
+	}
+
+	for i, exp := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		w := req(c, core.OpMutation)
+
+		if w.Code != exp {
+			t.Errorf("mutation %d: expected status %d got %d", i, exp, w.Code)
+		}
+		if i == 0 && w.Header().Get("RateLimit-Remaining") != "2" {
+			t.Errorf("expected 2 remaining got %s", w.Header().Get("RateLimit-Remaining"))
+		}
+		if exp == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Error("expected a Retry-After header")
+		}
+	}
+
+	// anonymous requests have no user to count by
+	if w := req(context.Background(), core.OpMutation); w.Code != http.StatusOK {
+		t.Errorf("expected anonymous mutation to be allowed got %d", w.Code)
+	}
+
+	c = context.WithValue(context.Background(), core.UserRoleKey, "admin,editor")
+
+	if err := rl.check(c, core.OpQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rl.check(c, core.OpQuery); err != errRateLimited {
+		t.Errorf("expected the admin role limit to be exceeded got %v", err)
+	}
+
+	// the role of users without one set by the auth is resolved
+	rl.roleFn = func(c context.Context) (string, error) {
+		if c.Value(core.UserIDKey) == 7 {
+			return "admin", nil
+		}
+		return "user", nil
+	}
+
+	c = context.WithValue(context.Background(), core.UserIDKey, 5)
+
+	for i := 0; i < 2; i++ {
+		if err := rl.check(c, core.OpQuery); err != nil {
+			t.Errorf("expected the user role to not be limited got %v", err)
+		}
+	}
+
+	c = context.WithValue(context.Background(), core.UserIDKey, 7)
+
+	if err := rl.check(c, core.OpQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rl.check(c, core.OpQuery); err != errRateLimited {
+		t.Errorf("expected the resolved admin role to be limited got %v", err)
+	}
+
+	sc.conf.RateLimiter.Limits = []RateLimit{{By: "ip", Limit: 1}}
+
+	if _, err := newRateLimits(sc); err == nil {
+		t.Error("expected an error for an invalid by")
+	}
+}
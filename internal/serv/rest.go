@@ -0,0 +1,254 @@
+package serv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dosco/graphjin/core"
+	"github.com/dosco/graphjin/internal/serv/internal/auth"
+	"go.opencensus.io/plugin/ochttp"
+)
+
+func apiV1RestHandler(servConf *ServConfig) http.Handler {
+	return withAuthAndCORS(servConf, http.HandlerFunc(apiV1Rest(servConf)))
+}
+
+// apiV1Rest exposes the named queries from the allow list as REST endpoints,
+// queries use GET and mutations POST. The variables are taken from the url
+// query params and the json body and checked against the declared types.
+func apiV1Rest(servConf *ServConfig) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ct := r.Context()
+		w.Header().Set("Content-Type", "application/json")
+
+		//nolint: errcheck
+		if servConf.conf.AuthFailBlock && !auth.IsAuth(ct) {
+			renderErr(w, errUnauthorized)
+			return
+		}
+
+		name := strings.TrimPrefix(r.URL.Path, restRoute)
+
+		nq, ok := gj.NamedQuery(name)
+		if !ok || nq.Operation == core.OpSubscription {
+			renderRestErr(w, http.StatusNotFound, fmt.Errorf("query not found: %s", name))
+			return
+		}
+
+		method := http.MethodGet
+		if nq.Operation == core.OpMutation {
+			method = http.MethodPost
+		}
+
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			renderRestErr(w, http.StatusMethodNotAllowed,
+				fmt.Errorf("method not allowed: %s, use %s", r.Method, method))
+			return
+		}
+
+		vars, err := restVars(r, nq)
+		if err != nil {
+			renderRestErr(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if !servConf.limits.allow(w, r, nq.Operation) {
+			return
+		}
+
+		rc := newReqConfig(servConf, r)
+
+		res, err := gj.GraphQLByName(ct, name, vars, &rc)
+
+		if err == nil {
+			if servConf.conf.CacheControl != "" && res.Operation() == core.OpQuery {
+				w.Header().Set("Cache-Control", servConf.conf.CacheControl)
+			}
+
+			//nolint: errcheck
+			err = json.NewEncoder(w).Encode(res)
+		}
+
+		if err != nil {
+			renderErr(w, err)
+		}
+
+		if servConf.conf.telemetryEnabled() {
+			ochttp.SetRoute(ct, restRoute)
+		}
+
+		if servConf.logLevel >= LogLevelInfo {
+			reqLog(servConf, res, err)
+		}
+	}
+}
+
+// restVars builds the query variables from the url query params and the json
+// body of requests other than GET, the body takes precedence. The declared
+// variables are converted to or checked against their GraphQL types.
+func restVars(r *http.Request, nq core.NamedQuery) (json.RawMessage, error) {
+	vars := make(map[string]interface{})
+	vm := make(map[string]core.QueryVar, len(nq.Vars))
+
+	for _, v := range nq.Vars {
+		vm[v.Name] = v
+	}
+
+	for k, v := range r.URL.Query() {
+		qv, ok := vm[k]
+		if !ok {
+			if len(v) == 1 {
+				vars[k] = v[0]
+			} else {
+				vars[k] = v
+			}
+			continue
+		}
+
+		val, err := parseRestParam(qv, v)
+		if err != nil {
+			return nil, err
+		}
+		vars[k] = val
+	}
+
+	if r.Method != http.MethodGet {
+		b, err := ioutil.ReadAll(io.LimitReader(r.Body, maxReadBytes))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Body.Close()
+
+		if len(bytes.TrimSpace(b)) != 0 {
+			var bv map[string]interface{}
+
+			d := json.NewDecoder(bytes.NewReader(b))
+			d.UseNumber()
+
+			if err := d.Decode(&bv); err != nil {
+				return nil, fmt.Errorf("request body must be a json object: %w", err)
+			}
+
+			for k, v := range bv {
+				if qv, ok := vm[k]; ok {
+					if err := checkRestVar(qv, v); err != nil {
+						return nil, err
+					}
+				}
+				vars[k] = v
+			}
+		}
+	}
+
+	for _, qv := range nq.Vars {
+		if v, ok := vars[qv.Name]; qv.Required && (!ok || v == nil) {
+			return nil, fmt.Errorf("variable '%s' is required", qv.Name)
+		}
+	}
+
+	return json.Marshal(vars)
+}
+
+// parseRestParam converts url query param values to the variable type,
+// list variables use repeated params (eg. ?id=1&id=2)
+func parseRestParam(qv core.QueryVar, vals []string) (interface{}, error) {
+	if !qv.List {
+		return parseRestValue(qv, vals[0])
+	}
+
+	list := make([]interface{}, len(vals))
+
+	for i, v := range vals {
+		v1, err := parseRestValue(qv, v)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = v1
+	}
+	return list, nil
+}
+
+func parseRestValue(qv core.QueryVar, v string) (interface{}, error) {
+	var val interface{}
+	var err error
+
+	switch qv.Type {
+	case "Int":
+		val, err = strconv.ParseInt(v, 10, 64)
+	case "Float":
+		val, err = strconv.ParseFloat(v, 64)
+	case "Boolean":
+		val, err = strconv.ParseBool(v)
+	case "String", "ID":
+		val = v
+	default:
+		err = json.Unmarshal([]byte(v), &val)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("variable '%s' should be of type '%s'", qv.Name, qv.Type)
+	}
+	return val, nil
+}
+
+func checkRestVar(qv core.QueryVar, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+
+	if !qv.List {
+		return checkRestValue(qv, v)
+	}
+
+	list, ok := v.([]interface{})
+	if !ok {
+		return fmt.Errorf("variable '%s' should be a list of type '%s'", qv.Name, qv.Type)
+	}
+
+	for _, v1 := range list {
+		if err := checkRestValue(qv, v1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkRestValue(qv core.QueryVar, v interface{}) error {
+	ok := true
+
+	switch qv.Type {
+	case "Int":
+		n, isNum := v.(json.Number)
+		_, err := n.Int64()
+		ok = isNum && err == nil
+	case "Float":
+		_, ok = v.(json.Number)
+	case "Boolean":
+		_, ok = v.(bool)
+	case "String":
+		_, ok = v.(string)
+	case "ID":
+		switch v.(type) {
+		case string, json.Number:
+		default:
+			ok = false
+		}
+	}
+
+	if !ok {
+		return fmt.Errorf("variable '%s' should be of type '%s'", qv.Name, qv.Type)
+	}
+	return nil
+}
+
+func renderRestErr(w http.ResponseWriter, code int, err error) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(errorResp{err.Error()}) //nolint: errcheck
+}
@@ -0,0 +1,91 @@
+package serv
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dosco/graphjin/core"
+)
+
+func TestRestVars(t *testing.T) {
+	nq := core.NamedQuery{
+		Name:      "getProducts",
+		Operation: core.OpQuery,
+		Vars: []core.QueryVar{
+			{Name: "limit", Type: "Int", Required: true},
+			{Name: "ids", Type: "ID", List: true},
+			{Name: "active", Type: "Boolean"},
+			{Name: "where", Type: "products_expression"},
+		},
+	}
+
+	r := httptest.NewRequest("GET",
+		`/api/v1/rest/getProducts?limit=10&ids=1&ids=2&active=true&where={"id":{"gt":5}}&other=x`, nil)
+
+	vars, err := restVars(r, nq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `{"active":true,"ids":["1","2"],"limit":10,"other":"x","where":{"id":{"gt":5}}}`
+
+	if string(vars) != exp {
+		t.Errorf("expected %s got %s", exp, vars)
+	}
+
+	errURLs := []string{
+		`/api/v1/rest/getProducts`,
+		`/api/v1/rest/getProducts?limit=ten`,
+		`/api/v1/rest/getProducts?limit=10&active=maybe`,
+		`/api/v1/rest/getProducts?limit=10&where={bad`,
+	}
+
+	for _, u := range errURLs {
+		if _, err := restVars(httptest.NewRequest("GET", u, nil), nq); err == nil {
+			t.Errorf("%s: expected error", u)
+		}
+	}
+}
+
+func TestRestVarsBody(t *testing.T) {
+	nq := core.NamedQuery{
+		Name:      "createProduct",
+		Operation: core.OpMutation,
+		Vars: []core.QueryVar{
+			{Name: "data", Type: "products_insert", Required: true},
+			{Name: "price", Type: "Float"},
+			{Name: "tags", Type: "String", List: true},
+		},
+	}
+
+	body := `{"data": {"name": "Beer"}, "price": 9.5, "tags": ["a", "b"]}`
+	r := httptest.NewRequest("POST", "/api/v1/rest/createProduct", strings.NewReader(body))
+
+	vars, err := restVars(r, nq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `{"data":{"name":"Beer"},"price":9.5,"tags":["a","b"]}`
+
+	if string(vars) != exp {
+		t.Errorf("expected %s got %s", exp, vars)
+	}
+
+	errBodies := []string{
+		`{"price": 9.5}`,
+		`{"data": {}, "price": "cheap"}`,
+		`{"data": {}, "tags": "a"}`,
+		`{"data": {}, "tags": [1]}`,
+		`[1]`,
+	}
+
+	for _, b := range errBodies {
+		r := httptest.NewRequest("POST", "/api/v1/rest/createProduct", strings.NewReader(b))
+
+		if _, err := restVars(r, nq); err == nil {
+			t.Errorf("%s: expected error", b)
+		}
+	}
+}
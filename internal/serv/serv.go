@@ -2,7 +2,9 @@ package serv
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -16,10 +18,30 @@ import (
 	"go.opencensus.io/plugin/ochttp"
 )
 
+const (
+	serverWriteTimeout = 10 * time.Second
+)
+
 var (
-	apiRoute string = "/api/v1/graphql"
+	apiRoute  string = "/api/v1/graphql"
+	sseRoute  string = "/api/v1/graphql/stream"
+	restRoute string = "/api/v1/rest/"
+	oaRoute   string = "/api/v1/openapi.json"
+	expRoute  string = "/api/v1/explain"
 )
 
+// noHTTP2 disables http/2 over tls, it applies the write timeout to each
+// stream and that can't be cleared for event streams with this go version
+var noHTTP2 = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+
+type connCtxKey struct{}
+
+// withConn saves the connection in the request context so
+// streams can clear the write deadline of their connection
+func withConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connCtxKey{}, c)
+}
+
 func initWatcher(sc *ServConfig) {
 	cpath := sc.conf.cpath
 	if sc.conf != nil && !sc.conf.WatchAndReload {
@@ -73,18 +95,39 @@ func startHTTP(sc *ServConfig) {
 		sc.log.Fatalf("Error setting up API routes: %s", err)
 	}
 
+	if len(sc.conf.EventTriggers) != 0 {
+		if err := setupEventTriggers(sc); err != nil {
+			sc.log.Fatalf("Error setting up event triggers: %s", err)
+		}
+		sc.conf.addCloseFn(startEventWorker(sc))
+	}
+
+	if len(sc.conf.Jobs) != 0 {
+		stopJobs, err := startJobs(sc)
+		if err != nil {
+			sc.log.Fatalf("Error starting jobs: %s", err)
+		}
+		sc.conf.addCloseFn(stopJobs)
+	}
+
 	srv := &http.Server{
 		Addr:           sc.conf.hostPort,
 		Handler:        routes,
 		ReadTimeout:    5 * time.Second,
-		WriteTimeout:   10 * time.Second,
+		WriteTimeout:   serverWriteTimeout,
 		MaxHeaderBytes: 1 << 20,
+		ConnContext:    withConn,
+		TLSNextProto:   noHTTP2,
 	}
 
 	if sc.conf.telemetryEnabled() {
 		srv.Handler = &ochttp.Handler{Handler: routes}
 	}
 
+	if srv.TLSConfig, err = initTLS(sc.conf); err != nil {
+		sc.log.Fatalf("Error setting up TLS: %s", err)
+	}
+
 	idleConnsClosed := make(chan struct{})
 	go func() {
 		sigint := make(chan os.Signal, 1)
@@ -108,7 +151,14 @@ func startHTTP(sc *ServConfig) {
 	sc.log.Infof("GraphJin started, version: %s, git-branch: %s, host-port: %s, app-name: %s, env: %s\n",
 		version, gitBranch, sc.conf.hostPort, appName, env)
 
-	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+	if srv.TLSConfig != nil {
+		// the certificate is loaded in the tls config
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+
+	if err != http.ErrServerClosed {
 		sc.log.Fatal("Server stopped")
 	}
 
@@ -125,25 +175,50 @@ func routeHandler(sc *ServConfig) (http.Handler, error) {
 
 	if sc.conf.APIPath != "" {
 		apiRoute = path.Join("/", sc.conf.APIPath, "/v1/graphql")
+		sseRoute = path.Join(apiRoute, "/stream")
+		restRoute = path.Join("/", sc.conf.APIPath, "/v1/rest") + "/"
+		oaRoute = path.Join("/", sc.conf.APIPath, "/v1/openapi.json")
+		expRoute = path.Join("/", sc.conf.APIPath, "/v1/explain")
+	}
+
+	if sc.limits, err = newRateLimits(sc); err != nil {
+		return nil, err
 	}
 
 	// Main GraphQL API handler
 	apiHandler := apiV1Handler(sc)
 
+	// Server-sent events handler for subscriptions
+	sseHandler := apiV1SSEHandler(sc)
+
+	// REST handler for the named queries in the allow list
+	restHandler := apiV1RestHandler(sc)
+
 	// API rate limiter
 	if sc.conf.rateLimiterEnable() {
 		apiHandler = rateLimiter(sc, apiHandler)
+		sseHandler = rateLimiter(sc, sseHandler)
+		restHandler = rateLimiter(sc, restHandler)
 	}
 
 	routes := map[string]http.Handler{
 		"/health": http.HandlerFunc(health(sc)),
 		apiRoute:  apiHandler,
+		restRoute: restHandler,
 	}
 
 	if err := setActionRoutes(sc, routes); err != nil {
 		return nil, err
 	}
 
+	if sc.conf.OpenAPIEndpoint || !sc.conf.Production {
+		routes[oaRoute] = apiV1OpenAPI(sc)
+	}
+
+	if sc.conf.ExplainEndpoint && !sc.conf.Production {
+		routes[expRoute] = apiV1ExplainHandler(sc)
+	}
+
 	if sc.conf.WebUI {
 		routes["/"] = http.FileServer(rice.MustFindBox("./web/build").HTTPBox())
 	}
@@ -155,6 +230,10 @@ func routeHandler(sc *ServConfig) (http.Handler, error) {
 		}
 	}
 
+	// event streams are flushed as they are written
+	// so they skip the gzip handler
+	routes[sseRoute] = sseHandler
+
 	for k, v := range routes {
 		mux.Handle(k, v)
 	}
@@ -180,18 +259,19 @@ func setServerHeader(h http.Handler) http.Handler {
 func setActionRoutes(sc *ServConfig, routes map[string]http.Handler) error {
 	var err error
 
-	for _, a := range sc.conf.Actions {
+	for i := range sc.conf.Actions {
 		var fn http.Handler
+		a := &sc.conf.Actions[i]
 
-		fn, err = newAction(sc, &a)
+		fn, err = newAction(sc, a)
 		if err != nil {
-			break
+			return err
 		}
 
 		p := fmt.Sprintf("/api/v1/actions/%s", strings.ToLower(a.Name))
 
 		if ac := findAuth(sc, a.AuthName); ac != nil {
-			routes[p], err = auth.WithAuth(fn, ac)
+			routes[p], err = auth.WithAuth(fn, ac, sc.db)
 		} else {
 			routes[p] = fn
 		}
@@ -0,0 +1,244 @@
+package serv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/dosco/graphjin/core"
+	"github.com/dosco/graphjin/internal/serv/internal/auth"
+	"go.opencensus.io/plugin/ochttp"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// shorter than the server write timeout so streams stay open
+	// even when the write deadline cannot be cleared
+	sseHeartbeat = serverWriteTimeout / 2
+)
+
+var (
+	errStreamingUnsupported = errors.New("streaming not supported")
+)
+
+type sseResult struct {
+	Data   json.RawMessage `json:"data,omitempty"`
+	Errors []sseErrMsg     `json:"errors,omitempty"`
+}
+
+type sseErrMsg struct {
+	Message string `json:"message"`
+}
+
+func apiV1SSEHandler(servConf *ServConfig) http.Handler {
+	return withAuthAndCORS(servConf, http.HandlerFunc(apiV1SSE(servConf)))
+}
+
+// apiV1SSE implements the "distinct connections" mode of the GraphQL over
+// server-sent events protocol. Each request carries a single operation and
+// the results are streamed as 'next' events followed by a 'complete' event.
+// https://github.com/enisdenjo/graphql-sse/blob/master/PROTOCOL.md
+func apiV1SSE(servConf *ServConfig) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ct := r.Context()
+
+		//nolint: errcheck
+		if servConf.conf.AuthFailBlock && !auth.IsAuth(ct) {
+			w.Header().Set("Content-Type", "application/json")
+			renderErr(w, errUnauthorized)
+			return
+		}
+
+		req, err := parseSSEReq(r)
+		if err != nil {
+			renderSSEErr(w, http.StatusBadRequest, err)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			renderSSEErr(w, http.StatusInternalServerError, errStreamingUnsupported)
+			return
+		}
+
+		op, _ := core.Operation(req.Query)
+
+		if !servConf.limits.allow(w, r, op) {
+			return
+		}
+
+		rc := newReqConfig(servConf, r)
+
+		if servConf.conf.telemetryEnabled() {
+			ochttp.SetRoute(ct, sseRoute)
+		}
+
+		// queries and mutations return a single result
+		if op != core.OpSubscription {
+			res, err := gj.GraphQLEx(ct, req.Query, req.Vars, &rc)
+
+			if servConf.logLevel >= LogLevelInfo {
+				reqLog(servConf, res, err)
+			}
+
+			startSSE(w)
+			writeSSEResult(w, res, err) //nolint: errcheck
+			flusher.Flush()
+			return
+		}
+
+		m, err := gj.SubscribeEx(ct, req.Query, req.Vars, &rc)
+		if err != nil {
+			renderSSEErr(w, http.StatusBadRequest, err)
+			return
+		}
+		defer m.Unsubscribe()
+
+		clearWriteDeadline(w, r)
+		startSSE(w)
+		flusher.Flush()
+
+		hb := time.NewTicker(sseHeartbeat)
+		defer hb.Stop()
+
+		for {
+			select {
+			case <-ct.Done():
+				// client disconnected
+				return
+
+			case v := <-m.Result:
+				err = writeSSE(w, "next", v)
+
+			case <-m.Done():
+				// the subscription was ended by the server
+				for len(m.Result) != 0 {
+					writeSSE(w, "next", <-m.Result) //nolint: errcheck
+				}
+				writeSSE(w, "complete", nil) //nolint: errcheck
+				flusher.Flush()
+				return
+
+			case <-hb.C:
+				_, err = io.WriteString(w, ":\n\n")
+			}
+
+			if err != nil {
+				if isDev() {
+					servConf.zlog.Error("Server-sent events", []zapcore.Field{zap.Error(err)}...)
+				}
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func parseSSEReq(r *http.Request) (gqlReq, error) {
+	var req gqlReq
+
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OpName = q.Get("operationName")
+
+		if v := q.Get("variables"); v != "" {
+			req.Vars = json.RawMessage(v)
+		}
+
+	case http.MethodPost:
+		b, err := ioutil.ReadAll(io.LimitReader(r.Body, maxReadBytes))
+		if err != nil {
+			return req, err
+		}
+		defer r.Body.Close()
+
+		if err := json.Unmarshal(b, &req); err != nil {
+			return req, err
+		}
+
+	default:
+		return req, fmt.Errorf("method not supported: %s", r.Method)
+	}
+
+	if req.Query == "" {
+		return req, errors.New("query is required")
+	}
+
+	if len(req.Vars) != 0 && !json.Valid(req.Vars) {
+		return req, errors.New("variables must be valid json")
+	}
+
+	return req, nil
+}
+
+func startSSE(w http.ResponseWriter) {
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeSSE(w io.Writer, event string, res *core.Result) error {
+	var data []byte
+	var err error
+
+	if res != nil {
+		sr := sseResult{Data: res.Data}
+		if res.Error != "" {
+			sr.Errors = []sseErrMsg{{Message: res.Error}}
+		}
+
+		if data, err = json.Marshal(sr); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
+
+// writeSSEResult writes the result of a query or mutation followed by the
+// complete event. Errors returned before the query runs are not set on
+// the result so they are sent in its place.
+func writeSSEResult(w io.Writer, res *core.Result, err error) error {
+	if err != nil && (res == nil || res.Error == "") {
+		res = &core.Result{Error: err.Error()}
+	}
+
+	if err := writeSSE(w, "next", res); err != nil {
+		return err
+	}
+	return writeSSE(w, "complete", nil)
+}
+
+func renderSSEErr(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	//nolint: errcheck
+	json.NewEncoder(w).Encode(sseResult{Errors: []sseErrMsg{{Message: err.Error()}}})
+}
+
+// clearWriteDeadline removes the server write timeout for long lived
+// streams. The connection is taken from the request context since the
+// response writer does not expose it, especially when it's wrapped.
+func clearWriteDeadline(w http.ResponseWriter, r *http.Request) {
+	if c, ok := r.Context().Value(connCtxKey{}).(net.Conn); ok {
+		c.SetWriteDeadline(time.Time{}) //nolint: errcheck
+		return
+	}
+
+	if wd, ok := w.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		wd.SetWriteDeadline(time.Time{}) //nolint: errcheck
+	}
+}
@@ -0,0 +1,170 @@
+package serv
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dosco/graphjin/core"
+	"go.opencensus.io/plugin/ochttp"
+)
+
+func TestParseSSEReq(t *testing.T) {
+	r := httptest.NewRequest("GET",
+		`/api/v1/graphql/stream?query=subscription+{+users+{+id+}+}&variables={"id":1}`, nil)
+
+	req, err := parseSSEReq(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Query != "subscription { users { id } }" {
+		t.Errorf("unexpected query: %s", req.Query)
+	}
+	if string(req.Vars) != `{"id":1}` {
+		t.Errorf("unexpected variables: %s", req.Vars)
+	}
+
+	r = httptest.NewRequest("POST", "/api/v1/graphql/stream",
+		strings.NewReader(`{"query":"subscription { users { id } }"}`))
+
+	if _, err := parseSSEReq(r); err != nil {
+		t.Fatal(err)
+	}
+
+	r = httptest.NewRequest("GET", `/api/v1/graphql/stream?query=x&variables={bad`, nil)
+
+	if _, err := parseSSEReq(r); err == nil {
+		t.Fatal("expected an error for invalid variables")
+	}
+}
+
+func TestWriteSSE(t *testing.T) {
+	var b bytes.Buffer
+
+	res := &core.Result{Data: []byte(`{ "users": [{ "id": 1 }] }`)}
+
+	if err := writeSSE(&b, "next", res); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeSSE(&b, "complete", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := "event: next\ndata: {\"data\":{\"users\":[{\"id\":1}]}}\n\n" +
+		"event: complete\ndata: \n\n"
+
+	if b.String() != exp {
+		t.Fatalf("expected %q got %q", exp, b.String())
+	}
+}
+
+func TestWriteSSEResultErr(t *testing.T) {
+	var b bytes.Buffer
+
+	// the query failed before it ran so the result has no error
+	if err := writeSSEResult(&b, &core.Result{}, errors.New("no database")); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := "event: next\ndata: {\"errors\":[{\"message\":\"no database\"}]}\n\n" +
+		"event: complete\ndata: \n\n"
+
+	if b.String() != exp {
+		t.Fatalf("expected %q got %q", exp, b.String())
+	}
+
+	b.Reset()
+
+	if err := writeSSEResult(&b, nil, errors.New("no database")); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.String() != exp {
+		t.Fatalf("expected %q got %q", exp, b.String())
+	}
+}
+
+// sseHeartbeats writes six heartbeats over 600ms
+var sseHeartbeats = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	clearWriteDeadline(w, r)
+	startSSE(w)
+
+	for i := 0; i < 6; i++ {
+		if _, err := io.WriteString(w, ":\n\n"); err != nil {
+			return
+		}
+		w.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+	}
+})
+
+func TestSSEWriteDeadline(t *testing.T) {
+	// the telemetry handler wraps the response writer
+	ts := httptest.NewUnstartedServer(&ochttp.Handler{Handler: sseHeartbeats})
+	ts.Config.WriteTimeout = 200 * time.Millisecond
+	ts.Config.ConnContext = withConn
+	ts.Start()
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := strings.Count(string(b), ":\n\n"); n != 6 {
+		t.Errorf("expected the stream to stay open past the write timeout, got %d heartbeats", n)
+	}
+}
+
+func TestSSEWriteDeadlineTLS(t *testing.T) {
+	// the test server is only used for its certificate and client
+	ts := httptest.NewUnstartedServer(http.NotFoundHandler())
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http.Server{
+		Handler:      sseHeartbeats,
+		WriteTimeout: 200 * time.Millisecond,
+		ConnContext:  withConn,
+		TLSNextProto: noHTTP2,
+		TLSConfig:    &tls.Config{Certificates: ts.TLS.Certificates},
+	}
+	go srv.ServeTLS(l, "", "") //nolint: errcheck
+	defer srv.Close()
+
+	res, err := ts.Client().Get("https://" + l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := strings.Count(string(b), ":\n\n"); n != 6 {
+		t.Errorf("expected the %s stream to stay open past the write timeout, got %d heartbeats",
+			res.Proto, n)
+	}
+}
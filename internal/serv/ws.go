@@ -2,9 +2,12 @@ package serv
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/dosco/graphjin/core"
@@ -14,6 +17,14 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
+const (
+	// Apollo's subscriptions-transport-ws protocol
+	wsProtoLegacy = "graphql-ws"
+
+	// The graphql-ws protocol
+	wsProtoTransport = "graphql-transport-ws"
+)
+
 type gqlWsReq struct {
 	ID      string `json:"id"`
 	Type    string `json:"type"`
@@ -37,17 +48,60 @@ type gqlWsError struct {
 	} `json:"payload"`
 }
 
+type gqlWsComplete struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
 type wsConnInit struct {
 	Type    string                 `json:"type,omitempty"`
 	Payload map[string]interface{} `json:"payload,omitempty"`
 }
 
+// wsProto formats the messages that differ between
+// the supported websocket protocols
+type wsProto interface {
+	dataMsg(id string, res *core.Result) interface{}
+	errorMsg(id string, err error) interface{}
+}
+
+// wsConn holds the state of a single websocket connection. A connection
+// can carry many concurrent operations each identified by the id
+// sent by the client.
+type wsConn struct {
+	servConf *ServConfig
+	auth     http.Handler
+	conn     *ws.Conn
+	proto    wsProto
+	ctx      context.Context
+	rc       core.ReqConfig
+
+	// gorilla websockets supports only one concurrent writer
+	wmu sync.Mutex
+
+	// running operations keyed by the operation id
+	smu  sync.Mutex
+	subs map[string]*wsSub
+}
+
+// wsSub is a running operation, subscriptions have a member
+// and queries and mutations a cancel func
+type wsSub struct {
+	m      *core.Member
+	res    <-chan *core.Result
+	ended  <-chan struct{}
+	cancel context.CancelFunc
+	done   chan bool
+}
+
+type wsLegacy struct{}
+
 var upgrader = ws.Upgrader{
 	EnableCompression: true,
 	ReadBufferSize:    1024,
 	WriteBufferSize:   1024,
 	HandshakeTimeout:  10 * time.Second,
-	Subprotocols:      []string{"graphql-ws"},
+	Subprotocols:      []string{wsProtoTransport, wsProtoLegacy},
 	CheckOrigin:       func(r *http.Request) bool { return true },
 }
 
@@ -65,157 +119,361 @@ func init() {
 	}
 }
 
-func apiV1Ws(servConf *ServConfig, w http.ResponseWriter, r *http.Request) {
-	var m *core.Member
-	var run bool
+type wsAuthCtxKey struct{}
 
-	ctx := r.Context()
+// wsAuthDone is the handler wrapped by the websocket auth, it
+// saves the context set by the auth for the connection
+func wsAuthDone(w http.ResponseWriter, r *http.Request) {
+	if v, ok := r.Context().Value(wsAuthCtxKey{}).(*context.Context); ok {
+		*v = r.Context()
+	}
+}
 
+func apiV1Ws(servConf *ServConfig, wsAuth http.Handler, w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		renderErr(w, err)
 		return
 	}
 	defer conn.Close()
-	conn.SetReadLimit(2048)
+	conn.SetReadLimit(maxReadBytes)
+
+	wc := &wsConn{
+		servConf: servConf,
+		auth:     wsAuth,
+		conn:     conn,
+		ctx:      r.Context(),
+		rc:       newReqConfig(servConf, r),
+		subs:     make(map[string]*wsSub),
+	}
+	defer wc.stopAll()
+
+	// clients that do not ask for a subprotocol get
+	// the legacy one
+	if conn.Subprotocol() == wsProtoTransport {
+		wc.proto = wsTransport{}
+		wc.serveTransport(w, r)
+	} else {
+		wc.proto = wsLegacy{}
+		wc.serveLegacy(w, r)
+	}
+}
 
+func (wc *wsConn) serveLegacy(w http.ResponseWriter, r *http.Request) {
 	var msg gqlWsReq
 	var b []byte
-
-	done := make(chan bool)
+	var err error
 
 	for {
-		if _, b, err = conn.ReadMessage(); err != nil {
-			servConf.zlog.Error("Websockets", []zapcore.Field{zap.Error(err)}...)
-			break
+		if _, b, err = wc.conn.ReadMessage(); err != nil {
+			wc.readErr(err)
+			return
 		}
 
+		msg = gqlWsReq{}
+
 		if err = json.Unmarshal(b, &msg); err != nil {
-			servConf.zlog.Error("Websockets", []zapcore.Field{zap.Error(err)}...)
+			wc.servConf.zlog.Error("Websockets", []zapcore.Field{zap.Error(err)}...)
 			continue
 		}
 
 		switch msg.Type {
 		case "connection_init":
-			var initReq wsConnInit
-
-			d := json.NewDecoder(bytes.NewReader(b))
-			d.UseNumber()
-
-			if err = d.Decode(&initReq); err != nil {
-				servConf.zlog.Error("Websockets", []zapcore.Field{zap.Error(err)}...)
-				break
-			}
-
-			hfn := func(writer http.ResponseWriter, request *http.Request) {
-				ctx = request.Context()
-				err = conn.WritePreparedMessage(initMsg)
-			}
-
-			handler, _ := auth.WithAuth(http.HandlerFunc(hfn), &servConf.conf.Auth)
-
-			if err != nil {
-				break
-			}
-
-			for k, v := range initReq.Payload {
-				switch v1 := v.(type) {
-				case string:
-					r.Header.Set(k, v1)
-				case json.Number:
-					r.Header.Set(k, v1.String())
-				}
+			if err = wc.authenticate(w, r, b); err == nil {
+				err = wc.writePrepared(initMsg)
 			}
-			handler.ServeHTTP(w, r)
 
 		case "start":
-			if run {
-				continue
-			}
-			m, err = gj.Subscribe(ctx, msg.Payload.Query, msg.Payload.Vars)
-			if err == nil {
-				go waitForData(servConf, done, conn, m)
-				run = true
+			if wc.running(msg.ID) {
+				err = fmt.Errorf("operation id already in use: %s", msg.ID)
+			} else {
+				err = wc.start(msg.ID, msg.Payload)
 			}
 
 		case "stop":
-			m.Unsubscribe()
-			done <- true
-			run = false
+			if wc.stop(msg.ID) {
+				err = wc.sendComplete(msg.ID)
+			}
+
+		case "connection_terminate":
+			return
 
 		default:
 			fields := []zapcore.Field{
 				zap.String("msg_type", msg.Type),
 				zap.Error(errors.New("unknown message type")),
 			}
-			servConf.zlog.Error("Subscription Error", fields...)
+			wc.servConf.zlog.Error("Subscription Error", fields...)
 		}
 
-		if err != nil {
-			err = sendError(conn, err)
-			break
+		if err == nil {
+			continue
+		}
+
+		wc.servConf.zlog.Error("Subscription Error", []zapcore.Field{zap.Error(err)}...)
+
+		// an error with a single operation is reported to the
+		// client, only a failed write ends the connection
+		if err = wc.sendError(msg.ID, err); err != nil {
+			return
+		}
+	}
+}
+
+// authenticate runs the configured auth handler against the
+// connection init payload which is treated as request headers.
+func (wc *wsConn) authenticate(w http.ResponseWriter, r *http.Request, b []byte) error {
+	var initReq wsConnInit
+	var ctx context.Context
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	if err := d.Decode(&initReq); err != nil {
+		return err
+	}
+
+	for k, v := range initReq.Payload {
+		switch v1 := v.(type) {
+		case string:
+			r.Header.Set(k, v1)
+		case json.Number:
+			r.Header.Set(k, v1.String())
 		}
 	}
+	wc.auth.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), wsAuthCtxKey{}, &ctx)))
+
+	if ctx == nil {
+		return errUnauthorized
+	}
+	wc.ctx = ctx
+
+	return nil
+}
+
+// start runs the operation, subscriptions are tracked under
+// the id till they are stopped.
+func (wc *wsConn) start(id string, req gqlReq) error {
+	//nolint: errcheck
+	if wc.servConf.conf.AuthFailBlock && !auth.IsAuth(wc.ctx) {
+		return errUnauthorized
+	}
+
+	op, _ := core.Operation(req.Query)
+
+	if err := wc.servConf.limits.check(wc.ctx, op); err != nil {
+		return err
+	}
 
+	if op != core.OpSubscription {
+		ctx, cancel := context.WithCancel(wc.ctx)
+		s := &wsSub{cancel: cancel, done: make(chan bool)}
+		wc.add(id, s)
+
+		// queries and mutations run in their own routine so a slow
+		// one does not hold up the other messages on the connection
+		go wc.execute(ctx, id, s, req)
+		return nil
+	}
+
+	m, err := gj.SubscribeEx(wc.ctx, req.Query, req.Vars, &wc.rc)
 	if err != nil {
-		servConf.zlog.Error("Subscription Error", []zapcore.Field{zap.Error(err)}...)
+		return err
 	}
 
-	m.Unsubscribe()
+	s := &wsSub{m: m, res: m.Result, ended: m.Done(), done: make(chan bool)}
+	wc.add(id, s)
+
+	go wc.waitForData(id, s)
+	return nil
 }
 
-func waitForData(servConf *ServConfig, done chan bool, conn *ws.Conn, m *core.Member) {
-	var buf bytes.Buffer
-	var err error
+// execute runs queries and mutations sent over the websocket, the
+// single result is followed by a 'complete' message. Nothing is sent
+// when the operation was stopped by the client.
+func (wc *wsConn) execute(ctx context.Context, id string, s *wsSub, req gqlReq) {
+	res, err := gj.GraphQLEx(ctx, req.Query, req.Vars, &wc.rc)
 
-	enc := json.NewEncoder(&buf)
+	if wc.servConf.logLevel >= LogLevelInfo {
+		reqLog(wc.servConf, res, err)
+	}
 
+	if !wc.remove(id, s) {
+		return
+	}
+	s.cancel()
+
+	if err == nil {
+		if err = wc.sendData(id, res); err == nil {
+			err = wc.sendComplete(id)
+		}
+	} else {
+		wc.servConf.zlog.Error("Subscription Error", []zapcore.Field{zap.Error(err)}...)
+		err = wc.sendError(id, err)
+	}
+
+	if err != nil && isDev() {
+		wc.servConf.zlog.Error("Websockets", []zapcore.Field{zap.Error(err)}...)
+	}
+}
+
+func (wc *wsConn) add(id string, s *wsSub) {
+	wc.smu.Lock()
+	wc.subs[id] = s
+	wc.smu.Unlock()
+}
+
+// remove returns false when the operation was already removed,
+// the caller that removes it ends the operation
+func (wc *wsConn) remove(id string, s *wsSub) bool {
+	wc.smu.Lock()
+	defer wc.smu.Unlock()
+
+	if wc.subs[id] != s {
+		return false
+	}
+	delete(wc.subs, id)
+	return true
+}
+
+func (wc *wsConn) running(id string) bool {
+	wc.smu.Lock()
+	defer wc.smu.Unlock()
+
+	_, ok := wc.subs[id]
+	return ok
+}
+
+// end stops the operation once it's removed
+func (s *wsSub) end() {
+	if s.cancel != nil {
+		s.cancel()
+	} else {
+		s.m.Unsubscribe()
+	}
+	close(s.done)
+}
+
+// stop ends the operation and returns false if no
+// operation was found for the id.
+func (wc *wsConn) stop(id string) bool {
+	wc.smu.Lock()
+	s, ok := wc.subs[id]
+	wc.smu.Unlock()
+
+	if !ok || !wc.remove(id, s) {
+		return false
+	}
+
+	s.end()
+	return true
+}
+
+func (wc *wsConn) stopAll() {
+	wc.smu.Lock()
+	ids := make([]string, 0, len(wc.subs))
+	for id := range wc.subs {
+		ids = append(ids, id)
+	}
+	wc.smu.Unlock()
+
+	for _, id := range ids {
+		wc.stop(id)
+	}
+}
+
+// waitForData sends the subscription results, when the subscription ends
+// on the server or a send fails it's removed and a 'complete' is sent
+func (wc *wsConn) waitForData(id string, s *wsSub) {
+	var err error
+
+loop:
 	for {
 		select {
-		case v := <-m.Result:
-			res := gqlWsResp{ID: "1", Type: "data"}
-			res.Payload.Data = v.Data
-
-			if v.Error != "" {
-				res.Payload.Errors = []string{v.Error}
+		case v := <-s.res:
+			if err = wc.sendData(id, v); err != nil {
+				break loop
 			}
 
-			if err = enc.Encode(res); err != nil {
-				continue
+		case <-s.ended:
+			// send the results left before the end
+			for {
+				select {
+				case v := <-s.res:
+					if err = wc.sendData(id, v); err != nil {
+						break loop
+					}
+				default:
+					break loop
+				}
 			}
-			msg := buf.Bytes()
-			buf.Reset()
 
-			if err = conn.WriteMessage(ws.TextMessage, msg); err != nil {
-				continue
-			}
-		case v := <-done:
-			if v {
-				return
-			}
+		case <-s.done:
+			return
 		}
+	}
 
-		if err != nil {
-			err = sendError(conn, err)
-			break
-		}
+	if !wc.remove(id, s) {
+		return
 	}
+	s.end()
 
 	if err != nil && isDev() {
-		servConf.zlog.Error("Websockets", []zapcore.Field{zap.Error(err)}...)
+		wc.servConf.zlog.Error("Websockets", []zapcore.Field{zap.Error(err)}...)
 	}
+
+	wc.sendComplete(id) //nolint: errcheck
 }
 
-func sendError(conn *ws.Conn, err error) error {
-	res := gqlWsError{ID: "1", Type: "error"}
-	res.Payload.Error = err.Error()
+func (wc *wsConn) readErr(err error) {
+	if ws.IsUnexpectedCloseError(err, ws.CloseNormalClosure, ws.CloseGoingAway) {
+		wc.servConf.zlog.Error("Websockets", []zapcore.Field{zap.Error(err)}...)
+	}
+}
+
+func (wc *wsConn) sendData(id string, v *core.Result) error {
+	return wc.writeJSON(wc.proto.dataMsg(id, v))
+}
+
+func (wc *wsConn) sendComplete(id string) error {
+	return wc.writeJSON(gqlWsComplete{ID: id, Type: "complete"})
+}
+
+func (wc *wsConn) sendError(id string, err error) error {
+	return wc.writeJSON(wc.proto.errorMsg(id, err))
+}
 
-	msg, err := json.Marshal(res)
+func (wc *wsConn) writeJSON(v interface{}) error {
+	msg, err := json.Marshal(v)
 	if err != nil {
 		return err
 	}
-	if err := conn.WriteMessage(ws.TextMessage, msg); err != nil {
-		return err
+
+	wc.wmu.Lock()
+	defer wc.wmu.Unlock()
+
+	return wc.conn.WriteMessage(ws.TextMessage, msg)
+}
+
+func (wc *wsConn) writePrepared(pm *ws.PreparedMessage) error {
+	wc.wmu.Lock()
+	defer wc.wmu.Unlock()
+
+	return wc.conn.WritePreparedMessage(pm)
+}
+
+func (wsLegacy) dataMsg(id string, v *core.Result) interface{} {
+	res := gqlWsResp{ID: id, Type: "data"}
+	res.Payload.Data = v.Data
+
+	if v.Error != "" {
+		res.Payload.Errors = []string{v.Error}
 	}
-	return nil
+	return res
+}
+
+func (wsLegacy) errorMsg(id string, err error) interface{} {
+	res := gqlWsError{ID: id, Type: "error"}
+	res.Payload.Error = err.Error()
+	return res
 }
@@ -0,0 +1,185 @@
+package serv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dosco/graphjin/core"
+	ws "github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+func newWsTestServer(t *testing.T) (*httptest.Server, *ServConfig) {
+	sc := &ServConfig{conf: &Config{}, zlog: zap.NewNop()}
+	sc.conf.Websockets.InitTimeout = 200 * time.Millisecond
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiV1Ws(sc, http.HandlerFunc(wsAuthDone), w, r)
+	}))
+	return ts, sc
+}
+
+func wsDial(t *testing.T, ts *httptest.Server, proto string) *ws.Conn {
+	d := ws.Dialer{Subprotocols: []string{proto}}
+	u := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+	conn, _, err := d.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.Subprotocol() != proto {
+		t.Fatalf("expected subprotocol '%s' got '%s'", proto, conn.Subprotocol())
+	}
+	return conn
+}
+
+func wsExpectClose(t *testing.T, conn *ws.Conn, code int) {
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !ws.IsCloseError(err, code) {
+			t.Fatalf("expected close code %d got: %s", code, err)
+		}
+		return
+	}
+}
+
+func TestWsTransportHandshake(t *testing.T) {
+	ts, _ := newWsTestServer(t)
+	defer ts.Close()
+
+	conn := wsDial(t, ts, wsProtoTransport)
+	defer conn.Close()
+
+	if err := conn.WriteJSON(gqlWtReq{Type: "connection_init"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var msg gqlWtReq
+
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "connection_ack" {
+		t.Fatalf("expected 'connection_ack' got '%s'", msg.Type)
+	}
+
+	if err := conn.WriteJSON(gqlWtReq{Type: "ping"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "pong" {
+		t.Fatalf("expected 'pong' got '%s'", msg.Type)
+	}
+
+	if err := conn.WriteJSON(gqlWtReq{Type: "connection_init"}); err != nil {
+		t.Fatal(err)
+	}
+	wsExpectClose(t, conn, wsCloseTooManyInitialise)
+}
+
+func TestWsTransportInitTimeout(t *testing.T) {
+	ts, _ := newWsTestServer(t)
+	defer ts.Close()
+
+	conn := wsDial(t, ts, wsProtoTransport)
+	defer conn.Close()
+
+	wsExpectClose(t, conn, wsCloseInitTimeout)
+}
+
+func TestWsTransportSubscribeBeforeAck(t *testing.T) {
+	ts, _ := newWsTestServer(t)
+	defer ts.Close()
+
+	conn := wsDial(t, ts, wsProtoTransport)
+	defer conn.Close()
+
+	err := conn.WriteJSON(gqlWtReq{
+		ID:      "1",
+		Type:    "subscribe",
+		Payload: []byte(`{"query":"subscription { users { id } }"}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsExpectClose(t, conn, wsCloseUnauthorized)
+}
+
+func TestWsLegacyNegotiated(t *testing.T) {
+	ts, _ := newWsTestServer(t)
+	defer ts.Close()
+
+	conn := wsDial(t, ts, wsProtoLegacy)
+	defer conn.Close()
+
+	if err := conn.WriteJSON(gqlWsReq{Type: "connection_init"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var msg gqlWsReq
+
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "connection_ack" {
+		t.Fatalf("expected 'connection_ack' got '%s'", msg.Type)
+	}
+}
+
+func TestWsSubscriptionEnded(t *testing.T) {
+	sc := &ServConfig{conf: &Config{}, zlog: zap.NewNop()}
+
+	res := make(chan *core.Result, 1)
+	ended := make(chan struct{})
+	conns := make(chan *wsConn, 1)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		wc := &wsConn{servConf: sc, conn: conn, proto: wsTransport{}, subs: make(map[string]*wsSub)}
+		s := &wsSub{res: res, ended: ended, done: make(chan bool)}
+
+		wc.add("1", s)
+		go wc.waitForData("1", s)
+		conns <- wc
+
+		conn.ReadMessage() //nolint: errcheck
+	}))
+	defer ts.Close()
+
+	conn := wsDial(t, ts, wsProtoTransport)
+	defer conn.Close()
+
+	wc := <-conns
+
+	// the subscription is ended by the server after a last result
+	res <- &core.Result{Data: []byte(`{"users":[]}`)}
+	close(ended)
+
+	var msg gqlWtReq
+
+	for _, exp := range []string{"next", "complete"} {
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != exp || msg.ID != "1" {
+			t.Fatalf("expected '%s' for '1' got '%s' for '%s'", exp, msg.Type, msg.ID)
+		}
+	}
+
+	if wc.running("1") {
+		t.Error("expected the ended subscription to be removed")
+	}
+}
@@ -0,0 +1,229 @@
+package serv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dosco/graphjin/core"
+	ws "github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Close codes defined by the graphql-transport-ws protocol
+const (
+	wsCloseBadRequest        = 4400
+	wsCloseUnauthorized      = 4401
+	wsCloseForbidden         = 4403
+	wsCloseInitTimeout       = 4408
+	wsCloseSubscriberExists  = 4409
+	wsCloseTooManyInitialise = 4429
+)
+
+const (
+	defaultWsInitTimeout  = 10 * time.Second
+	defaultWsPingInterval = 12 * time.Second
+)
+
+type gqlWtReq struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type gqlWtNext struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Payload struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []gqlWtErrMsg   `json:"errors,omitempty"`
+	} `json:"payload"`
+}
+
+type gqlWtError struct {
+	ID      string        `json:"id"`
+	Type    string        `json:"type"`
+	Payload []gqlWtErrMsg `json:"payload"`
+}
+
+type gqlWtErrMsg struct {
+	Message string `json:"message"`
+}
+
+type gqlWtPing struct {
+	Type string `json:"type"`
+}
+
+type wsTransport struct{}
+
+// serveTransport implements the graphql-transport-ws protocol
+// https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+func (wc *wsConn) serveTransport(w http.ResponseWriter, r *http.Request) {
+	var msg gqlWtReq
+	var b []byte
+	var err error
+
+	initTimeout := wc.servConf.conf.Websockets.InitTimeout
+	if initTimeout == 0 {
+		initTimeout = defaultWsInitTimeout
+	}
+
+	pingInterval := wc.servConf.conf.Websockets.PingInterval
+	if pingInterval == 0 {
+		pingInterval = defaultWsPingInterval
+	}
+
+	var initMu sync.Mutex
+	var initRecv, acked bool
+
+	initTimer := time.AfterFunc(initTimeout, func() {
+		initMu.Lock()
+		defer initMu.Unlock()
+
+		if !initRecv {
+			wc.close(wsCloseInitTimeout, "Connection initialisation timeout")
+		}
+	})
+	defer initTimer.Stop()
+
+	done := make(chan bool)
+	defer close(done)
+
+	// a client that does not answer the keepalive pings
+	// with any message for two intervals is dropped
+	if pingInterval > 0 {
+		go wc.keepAlive(pingInterval, done)
+	}
+
+	for {
+		if pingInterval > 0 {
+			wc.conn.SetReadDeadline(time.Now().Add(pingInterval * 2)) //nolint: errcheck
+		}
+
+		if _, b, err = wc.conn.ReadMessage(); err != nil {
+			wc.readErr(err)
+			return
+		}
+
+		msg = gqlWtReq{}
+
+		if err = json.Unmarshal(b, &msg); err != nil {
+			wc.close(wsCloseBadRequest, "Invalid message received")
+			return
+		}
+
+		switch msg.Type {
+		case "connection_init":
+			initMu.Lock()
+			dup := initRecv
+			initRecv = true
+			initMu.Unlock()
+
+			if dup {
+				wc.close(wsCloseTooManyInitialise, "Too many initialisation requests")
+				return
+			}
+
+			if err = wc.authenticate(w, r, b); err != nil {
+				wc.close(wsCloseForbidden, "Forbidden")
+				return
+			}
+
+			if err = wc.writeJSON(gqlWtPing{Type: "connection_ack"}); err != nil {
+				return
+			}
+			acked = true
+
+		case "ping":
+			err = wc.writeJSON(gqlWtPing{Type: "pong"})
+
+		case "pong":
+			// keepalive response, the read deadline is already extended
+
+		case "subscribe":
+			if !acked {
+				wc.close(wsCloseUnauthorized, "Unauthorized")
+				return
+			}
+
+			if wc.running(msg.ID) {
+				wc.close(wsCloseSubscriberExists, fmt.Sprintf("Subscriber for %s already exists", msg.ID))
+				return
+			}
+
+			var req gqlReq
+
+			if msg.ID == "" || json.Unmarshal(msg.Payload, &req) != nil {
+				wc.close(wsCloseBadRequest, "Invalid message received")
+				return
+			}
+
+			if err = wc.start(msg.ID, req); err != nil {
+				wc.servConf.zlog.Error("Subscription Error", []zapcore.Field{zap.Error(err)}...)
+				err = wc.sendError(msg.ID, err)
+			}
+
+		case "complete":
+			// the client is no longer listening so no complete
+			// message is sent back
+			wc.stop(msg.ID)
+
+		default:
+			wc.close(wsCloseBadRequest, fmt.Sprintf("Invalid message type: %s", msg.Type))
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (wc *wsConn) keepAlive(interval time.Duration, done chan bool) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if err := wc.writeJSON(gqlWtPing{Type: "ping"}); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// close sends a close frame with the protocol close code and
+// closes the connection which in turn ends the read loop.
+func (wc *wsConn) close(code int, reason string) {
+	msg := ws.FormatCloseMessage(code, reason)
+
+	wc.wmu.Lock()
+	wc.conn.WriteControl(ws.CloseMessage, msg, time.Now().Add(time.Second)) //nolint: errcheck
+	wc.wmu.Unlock()
+
+	wc.conn.Close()
+}
+
+func (wsTransport) dataMsg(id string, v *core.Result) interface{} {
+	res := gqlWtNext{ID: id, Type: "next"}
+	res.Payload.Data = v.Data
+
+	if v.Error != "" {
+		res.Payload.Errors = []gqlWtErrMsg{{Message: v.Error}}
+	}
+	return res
+}
+
+func (wsTransport) errorMsg(id string, err error) interface{} {
+	return gqlWtError{
+		ID:      id,
+		Type:    "error",
+		Payload: []gqlWtErrMsg{{Message: err.Error()}},
+	}
+}